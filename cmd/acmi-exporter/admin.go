@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/rs/zerolog/log"
+)
+
+// adminShutdownTimeout is how long the admin server waits for requests to finish when shutting down.
+const adminShutdownTimeout = 5 * time.Second
+
+// serveAdmin serves an HTTP API for managing publishers at runtime until the context is cancelled:
+//
+//	GET    /publishers                List publishers and their status.
+//	PUT    /publishers/{name}         Attach a publisher. The body is a JSON object of options, as in the config file.
+//	DELETE /publishers/{name}         Detach a publisher.
+//	POST   /publishers/{name}/restart Restart a publisher.
+//
+// If token is not empty, every request must carry it as a bearer token. File publishers may only be attached if folder
+// is not empty, and must write within it.
+func serveAdmin(ctx context.Context, address, token, folder string, manager *publishers.Manager) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           adminHandler(manager, token, folder),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Warn().Err(err).Msg("failed to shut down admin server")
+		}
+	}()
+
+	log.Info().Str("address", address).Msg("serving admin API")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// adminHandler returns the handler for the admin API.
+func adminHandler(manager *publishers.Manager, token, folder string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /publishers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, manager.Statuses())
+	})
+	mux.HandleFunc("PUT /publishers/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var options map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode options: %w", err))
+			return
+		}
+		instance, err := buildPublisher(name, options)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if file, ok := instance.publisher.(*publishers.FilePublisher); ok {
+			if err := confineFolder(file, folder); err != nil {
+				writeError(w, http.StatusForbidden, err)
+				return
+			}
+		}
+		if err := manager.Attach(instance.name, instance.publisher, instance.queueSize, instance.overflowPolicy); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("DELETE /publishers/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Detach(r.PathValue("name")); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /publishers/{name}/restart", func(w http.ResponseWriter, r *http.Request) {
+		if err := manager.Restart(r.PathValue("name")); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if token == "" {
+		return mux
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// confineFolder places a file publisher's folder within the given root. A relative folder is resolved against the root,
+// and an absolute folder must already be within it.
+func confineFolder(p *publishers.FilePublisher, root string) error {
+	if root == "" {
+		return errors.New("file publishers cannot be attached unless admin-folder is set")
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve admin-folder: %w", err)
+	}
+	folder := p.Folder
+	if !filepath.IsAbs(folder) {
+		folder = filepath.Join(root, folder)
+	}
+	folder = filepath.Clean(folder)
+	relative, err := filepath.Rel(root, folder)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("folder %q is not within admin-folder", p.Folder)
+	}
+	p.Folder = folder
+	return nil
+}
+
+// isLoopback returns true if the address only listens on a loopback interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warn().Err(err).Msg("failed to write admin response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
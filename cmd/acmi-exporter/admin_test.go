@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminRequest sends a request to the admin handler, with the given bearer token if it is not empty.
+func adminRequest(t *testing.T, handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	t.Parallel()
+	handler := adminHandler(publishers.NewManager(), "hunter2", "")
+
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, handler, http.MethodGet, "/publishers", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, adminRequest(t, handler, http.MethodGet, "/publishers", "wrong", "").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(t, handler, http.MethodGet, "/publishers", "hunter2", "").Code)
+}
+
+func TestAdminConfinesFileFolders(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	manager := publishers.NewManager()
+	handler := adminHandler(manager, "", root)
+
+	outside := adminRequest(t, handler, http.MethodPut, "/publishers/outside", "", `{"type": "file", "folder": "/etc"}`)
+	assert.Equal(t, http.StatusForbidden, outside.Code)
+	escaping := adminRequest(t, handler, http.MethodPut, "/publishers/escaping", "", `{"type": "file", "folder": "../sorties"}`)
+	assert.Equal(t, http.StatusForbidden, escaping.Code)
+
+	inside := adminRequest(t, handler, http.MethodPut, "/publishers/inside", "", `{"type": "file", "folder": "sorties"}`)
+	require.Equal(t, http.StatusCreated, inside.Code)
+	statuses := manager.Statuses()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "inside", statuses[0].Name)
+
+	unconfined := adminHandler(publishers.NewManager(), "", "")
+	refused := adminRequest(t, unconfined, http.MethodPut, "/publishers/sortie", "", `{"type": "file", "folder": "`+filepath.Join(root, "sorties")+`"}`)
+	assert.Equal(t, http.StatusForbidden, refused.Code, "file publishers are refused without an admin folder")
+}
+
+func TestIsLoopback(t *testing.T) {
+	t.Parallel()
+	for address, expected := range map[string]bool{
+		"localhost:8080": true,
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+		"localhost":      false,
+	} {
+		assert.Equal(t, expected, isLoopback(address), address)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/dharmab/acmi-exporter/pkg/streamer"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of environment variables which override settings. For example, the password setting is read
+// from ACMI_EXPORTER_PASSWORD.
+const envPrefix = "ACMI_EXPORTER"
+
+// config holds the settings read from the config file and environment variables. It is set by initializeConfig.
+var config *viper.Viper
+
+// rawConfig holds the config file as it was written. Viper lower cases every key, so maps whose keys are data rather
+// than setting names, such as passwords and publisher names, are read from here instead. It is set by
+// initializeConfig, and is nil if there is no config file or its format is not supported.
+var rawConfig map[string]any
+
+// coalitionMapping is the parsed value of the coalitions setting. It is set by validateConfig.
+var coalitionMapping streamer.CoalitionMapping
+
+// initializeConfig applies settings from the config file and environment variables to any flags which were not set on
+// the command line. Command line flags take precedence over environment variables, which take precedence over the
+// config file.
+func initializeConfig(cmd *cobra.Command) error {
+	v := viper.New()
+
+	// The environment is bound first, so that the config file itself can be chosen by an environment variable.
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+	if f := cmd.Flags().Lookup("config-file"); f != nil && !f.Changed && v.IsSet(f.Name) {
+		configFile = v.GetString(f.Name)
+	}
+
+	rawConfig = nil
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			// having no config file is fine
+			if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to read config file %s: %w", configFile, err)
+			}
+		} else {
+			raw, err := readRawConfig(configFile)
+			if err != nil {
+				return fmt.Errorf("failed to read config file %s: %w", configFile, err)
+			}
+			rawConfig = raw
+		}
+	}
+
+	config = v
+	return bindFlags(cmd, v)
+}
+
+// readRawConfig decodes a YAML, JSON or TOML config file without changing the case of its keys. Returns nil for other
+// formats.
+func readRawConfig(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, nil
+	}
+	return raw, err
+}
+
+// rawSetting returns the value of a top-level setting in the config file as it was written. Setting names are matched
+// regardless of case, as viper matches them.
+func rawSetting(key string) (any, bool) {
+	for k, value := range rawConfig {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// bindFlags sets each flag which was not set on the command line to the value from viper, if viper has a value.
+func bindFlags(cmd *cobra.Command, v *viper.Viper) error {
+	var errs []error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || !v.IsSet(f.Name) {
+			return
+		}
+		value := v.Get(f.Name)
+		// Only the config file holds maps, and their keys are read as written.
+		if _, ok := value.(map[string]any); ok {
+			if raw, ok := rawSetting(f.Name); ok {
+				value = raw
+			}
+		}
+		if err := cmd.Flags().Set(f.Name, flagValue(value)); err != nil {
+			errs = append(errs, invalidSetting(f.Name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// flagValue formats a value from a config file or environment variable as a flag value. Maps are formatted as
+// key=value pairs and lists as comma-separated values.
+func flagValue(value any) string {
+	switch value := value.(type) {
+	case map[string]any:
+		m := cast.ToStringMapString(value)
+		pairs := make([]string, 0, len(m))
+		for k, v := range m {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case []any:
+		return strings.Join(cast.ToStringSlice(value), ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// invalidSetting returns an error which names the setting with an invalid value.
+func invalidSetting(key string, err error) error {
+	return fmt.Errorf("invalid setting %q: %w", key, err)
+}
+
+// validateConfig checks that every setting has a valid value.
+func validateConfig() error {
+	var errs []error
+	check := func(key string, err error) {
+		if err != nil {
+			errs = append(errs, invalidSetting(key, err))
+		}
+	}
+	notEmpty := func(key, value string) {
+		if value == "" {
+			check(key, errors.New("must not be empty"))
+		}
+	}
+	positive := func(key string, value any, ok bool) {
+		if !ok {
+			check(key, fmt.Errorf("must be positive, got %v", value))
+		}
+	}
+	notNegative := func(key string, value any, ok bool) {
+		if !ok {
+			check(key, fmt.Errorf("must not be negative, got %v", value))
+		}
+	}
+
+	notEmpty("grpc-address", grpcAddress)
+	positive("air-unit-update-interval", airUnitUpdateInterval, airUnitUpdateInterval > 0)
+	positive("surface-unit-update-interval", surfaceUnitUpdateInterval, surfaceUnitUpdateInterval > 0)
+	positive("weapon-update-interval", weaponUpdateInterval, weaponUpdateInterval > 0)
+	positive("publisher-queue-size", publisherQueueSize, publisherQueueSize > 0)
+	notNegative("rotate-size", rotateSize, rotateSize >= 0)
+	notNegative("rotate-duration", rotateDuration, rotateDuration >= 0)
+	notNegative("rotate-mission-duration", rotateMissionDuration, rotateMissionDuration >= 0)
+	notNegative("reorder-window", reorderWindow, reorderWindow >= 0)
+	notNegative("lon-lat-precision", lonLatPrecision, lonLatPrecision >= 0)
+	notNegative("altitude-precision", altitudePrecision, altitudePrecision >= 0)
+	notNegative("attitude-precision", attitudePrecision, attitudePrecision >= 0)
+	notNegative("native-coordinate-precision", nativePrecision, nativePrecision >= 0)
+	notNegative("global-refresh-interval", globalRefreshInterval, globalRefreshInterval >= 0)
+	if adaptiveRates {
+		notNegative("adaptive-turn-rate-threshold", adaptiveTurnRate, adaptiveTurnRate >= 0)
+		notNegative("adaptive-acceleration-threshold", adaptiveAcceleration, adaptiveAcceleration >= 0)
+		notNegative("adaptive-proximity-threshold", adaptiveProximity, adaptiveProximity >= 0)
+		positive("adaptive-slow-interval", adaptiveSlowInterval, adaptiveSlowInterval > 0)
+		notNegative("adaptive-update-budget", adaptiveBudget, adaptiveBudget >= 0)
+	}
+	if deadReckoning {
+		notNegative("dead-reckoning-position-threshold", deadReckoningPosition, deadReckoningPosition >= 0)
+		notNegative("dead-reckoning-altitude-threshold", deadReckoningAltitude, deadReckoningAltitude >= 0)
+		notNegative("dead-reckoning-attitude-threshold", deadReckoningAttitude, deadReckoningAttitude >= 0)
+		positive("dead-reckoning-max-silence", deadReckoningMaxSilence, deadReckoningMaxSilence > 0)
+	}
+	if delayedTelemetryAddress != "" {
+		positive("telemetry-delay", telemetryDelay, telemetryDelay > 0)
+	}
+	if adminAddress != "" && adminToken == "" && !isLoopback(adminAddress) {
+		check("admin-token", errors.New("must be set when the admin address is not a loopback address"))
+	}
+
+	_, err := publishers.ParseOverflowPolicy(publisherOverflowPolicy)
+	check("publisher-overflow-policy", err)
+	_, err = publishers.ParseSlowClientPolicy(slowClientPolicy)
+	check("telemetry-slow-client-policy", err)
+	_, err = parseViews(telemetryViews, password)
+	check("telemetry-views", err)
+	_, err = parseViews(delayedTelemetryViews, delayedPassword)
+	check("delayed-telemetry-views", err)
+	coalitionMapping, err = streamer.ParseCoalitionMapping(coalitionNames)
+	check("coalitions", err)
+
+	return errors.Join(errs...)
+}
+
+// parseViews parses telemetry view passwords, each of which must differ from the main password.
+func parseViews(names map[string]string, mainPassword string) (map[string]publishers.View, error) {
+	views := make(map[string]publishers.View, len(names))
+	for viewPassword, name := range names {
+		view, err := publishers.ParseView(name)
+		if err != nil {
+			return nil, err
+		}
+		if viewPassword == mainPassword {
+			return nil, fmt.Errorf("password for %s view must differ from the main password", view)
+		}
+		views[viewPassword] = view
+	}
+	return views, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadTestConfig writes a config file, chooses it with the ACMI_EXPORTER_CONFIG_FILE environment variable and
+// initializes the config of a command with the config-file and telemetry-views flags. The settings are reset when the
+// test ends. Tests which use it must not be parallel, since the settings are global.
+func loadTestConfig(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	t.Setenv("ACMI_EXPORTER_CONFIG_FILE", path)
+
+	previousConfigFile, previousViews := configFile, telemetryViews
+	t.Cleanup(func() {
+		configFile, telemetryViews = previousConfigFile, previousViews
+		config, rawConfig = nil, nil
+	})
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&configFile, "config-file", "/nonexistent/config.yaml", "")
+	cmd.Flags().StringToStringVar(&telemetryViews, "telemetry-views", nil, "")
+	require.NoError(t, initializeConfig(cmd))
+}
+
+func TestConfigKeepsPasswordCase(t *testing.T) {
+	loadTestConfig(t, "config.yaml", "telemetry-views:\n  BlueTeamPW: blue\n  redteampw: red\n")
+	assert.Equal(t, map[string]string{"BlueTeamPW": "blue", "redteampw": "red"}, telemetryViews)
+}
+
+func TestConfigKeepsPasswordCaseInTOML(t *testing.T) {
+	loadTestConfig(t, "config.toml", "[Telemetry-Views]\nBlueTeamPW = \"blue\"\n")
+	assert.Equal(t, map[string]string{"BlueTeamPW": "blue"}, telemetryViews)
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/coalition"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/hook"
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/world"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
 	"github.com/dharmab/acmi-exporter/pkg/publishers"
 	"github.com/dharmab/acmi-exporter/pkg/streamer"
+	"github.com/dharmab/goacmi/objects"
+	measure "github.com/martinlindhe/unit"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
@@ -22,34 +28,109 @@ import (
 )
 
 var (
+	configFile                string
 	grpcAddress               string
 	telemetryAddress          string
+	delayedTelemetryAddress   string
+	telemetryDelay            time.Duration
 	hostname                  string
 	password                  string
+	telemetryViews            map[string]string
+	delayedPassword           string
+	delayedTelemetryViews     map[string]string
+	coalitionNames            map[string]string
 	airUnitUpdateInterval     time.Duration
 	surfaceUnitUpdateInterval time.Duration
 	weaponUpdateInterval      time.Duration
+	reorderWindow             time.Duration
+	globalRefreshInterval     time.Duration
+	lonLatPrecision           int
+	altitudePrecision         int
+	attitudePrecision         int
+	nativePrecision           int
+	adaptiveRates             bool
+	adaptiveTurnRate          float64
+	adaptiveAcceleration      float64
+	adaptiveProximity         float64
+	adaptiveSlowInterval      time.Duration
+	adaptiveBudget            float64
+	deadReckoning             bool
+	deadReckoningPosition     float64
+	deadReckoningAltitude     float64
+	deadReckoningAttitude     float64
+	deadReckoningMaxSilence   time.Duration
 	publishStdout             bool
+	stdoutFormat              string
 	publishToFolder           string
+	compressRecordings        bool
+	rotateSize                int64
+	rotateDuration            time.Duration
+	rotateMissionDuration     time.Duration
+	resumeRecordings          bool
+	publisherQueueSize        int
+	publisherOverflowPolicy   string
+	slowClientPolicy          string
+	adminAddress              string
+	adminToken                string
+	adminFolder               string
 )
 
 var exporterCmd = &cobra.Command{
 	Use:   "acmi-exporter",
 	Short: "ACMI exporter",
 	Long:  `ACMI exporter`,
-	RunE:  Run,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return initializeConfig(cmd)
+	},
+	RunE: Run,
 }
 
 func init() {
+	exporterCmd.PersistentFlags().StringVar(&configFile, "config-file", "/etc/acmi-exporter/config.yaml", "Path to a YAML or TOML config file. Every other flag may be set in this file, or by an environment variable such as ACMI_EXPORTER_GRPC_ADDRESS")
 	exporterCmd.PersistentFlags().StringVar(&grpcAddress, "grpc-address", "localhost:50051", "Address of the DCS-gRPC server")
-	exporterCmd.PersistentFlags().StringVar(&telemetryAddress, "telemetry-address", "localhost:42675", "Address to serve telemetry on")
+	exporterCmd.PersistentFlags().StringVar(&telemetryAddress, "telemetry-address", "localhost:42675", "Address to serve telemetry on (disabled if empty)")
+	exporterCmd.PersistentFlags().StringVar(&delayedTelemetryAddress, "delayed-telemetry-address", "", "Address to serve delayed telemetry on (disabled if empty)")
+	exporterCmd.PersistentFlags().DurationVar(&telemetryDelay, "telemetry-delay", 5*time.Minute, "How far delayed telemetry is held back")
+	exporterCmd.PersistentFlags().StringVar(&slowClientPolicy, "telemetry-slow-client-policy", string(publishers.ResyncSlowClients), "What to do when a telemetry client cannot keep up (resync, disconnect)")
 	exporterCmd.PersistentFlags().StringVar(&hostname, "hostname", "acmi-exporter", "ACMI protocol hostname")
 	exporterCmd.PersistentFlags().StringVar(&password, "password", "", "ACMI protocol password")
-	exporterCmd.PersistentFlags().DurationVar(&airUnitUpdateInterval, "air-unit-update-interval", time.Second, "How often to publish frames for air units")
-	exporterCmd.PersistentFlags().DurationVar(&surfaceUnitUpdateInterval, "surface-unit-update-interval", time.Second, "How often to publish frames for surface units")
+	exporterCmd.PersistentFlags().StringToStringVar(&telemetryViews, "telemetry-views", nil, "Additional ACMI protocol passwords, each mapped to a restricted view (e.g. bluepass=blue,redpass=red). Views: spectator, blue, red")
+	exporterCmd.PersistentFlags().StringVar(&delayedPassword, "delayed-telemetry-password", "", "ACMI protocol password for delayed telemetry. It must differ from the live telemetry passwords")
+	exporterCmd.PersistentFlags().StringToStringVar(&delayedTelemetryViews, "delayed-telemetry-views", nil, "Additional ACMI protocol passwords for delayed telemetry, each mapped to a restricted view. They must differ from the live telemetry passwords")
+	exporterCmd.PersistentFlags().StringToStringVar(&coalitionNames, "coalitions", nil, "ACMI coalition of each DCS coalition (e.g. blue=Allies,red=Enemies,neutral=Neutrals, which is the default)")
+	exporterCmd.PersistentFlags().DurationVar(&airUnitUpdateInterval, "air-unit-update-interval", time.Second, "How often to publish frames for air units. Intervals under a second, such as 250ms, poll unit positions through the DCS-gRPC Lua API")
+	exporterCmd.PersistentFlags().DurationVar(&surfaceUnitUpdateInterval, "surface-unit-update-interval", time.Second, "How often to publish frames for surface units. Intervals under a second poll unit positions through the DCS-gRPC Lua API")
 	exporterCmd.PersistentFlags().DurationVar(&weaponUpdateInterval, "weapon-update-interval", time.Second, "How often to publish frames for weapons")
+	exporterCmd.PersistentFlags().DurationVar(&reorderWindow, "reorder-window", 2*time.Second, "How long to hold each frame so that updates which arrive late from the unit streams are recorded at the correct time (0 to disable)")
+	exporterCmd.PersistentFlags().DurationVar(&globalRefreshInterval, "global-refresh-interval", 30*time.Second, "How often to check the bullseyes and mission properties for changes made by mission scripts (0 to disable)")
+	exporterCmd.PersistentFlags().IntVar(&lonLatPrecision, "lon-lat-precision", streamer.DefaultPrecision.LongitudeLatitude, "Decimal places of longitude and latitude in transforms")
+	exporterCmd.PersistentFlags().IntVar(&altitudePrecision, "altitude-precision", streamer.DefaultPrecision.Altitude, "Decimal places of altitude in meters in transforms")
+	exporterCmd.PersistentFlags().IntVar(&attitudePrecision, "attitude-precision", streamer.DefaultPrecision.Attitude, "Decimal places of roll, pitch, yaw and heading in degrees in transforms")
+	exporterCmd.PersistentFlags().IntVar(&nativePrecision, "native-coordinate-precision", streamer.DefaultPrecision.Native, "Decimal places of the native DCS coordinates in meters in transforms")
+	exporterCmd.PersistentFlags().BoolVar(&adaptiveRates, "adaptive-update-rates", false, "Update units which are turning, accelerating or near other aircraft at the air or surface unit update interval, and other units at the slow interval. Units are never updated more often than they are polled")
+	exporterCmd.PersistentFlags().Float64Var(&adaptiveTurnRate, "adaptive-turn-rate-threshold", 3, "Rate of turn in degrees per second above which a unit is updated at the full rate")
+	exporterCmd.PersistentFlags().Float64Var(&adaptiveAcceleration, "adaptive-acceleration-threshold", 5, "Change of speed in meters per second per second above which a unit is updated at the full rate")
+	exporterCmd.PersistentFlags().Float64Var(&adaptiveProximity, "adaptive-proximity-threshold", 10000, "Distance in meters from another aircraft within which an aircraft is updated at the full rate")
+	exporterCmd.PersistentFlags().DurationVar(&adaptiveSlowInterval, "adaptive-slow-interval", 5*time.Second, "How often to update units which are cruising or parked")
+	exporterCmd.PersistentFlags().Float64Var(&adaptiveBudget, "adaptive-update-budget", 0, "Maximum number of unit updates per second. Every unit's interval is lengthened in proportion to stay within the budget, so this can only lower update rates (0 for no limit)")
+	exporterCmd.PersistentFlags().BoolVar(&deadReckoning, "dead-reckoning", false, "Suppress updates for objects whose position and attitude can be extrapolated from their previous updates, such as parked aircraft and anchored ships")
+	exporterCmd.PersistentFlags().Float64Var(&deadReckoningPosition, "dead-reckoning-position-threshold", 5, "Horizontal distance in meters from the extrapolated position beyond which an update is sent")
+	exporterCmd.PersistentFlags().Float64Var(&deadReckoningAltitude, "dead-reckoning-altitude-threshold", 3, "Distance in meters from the extrapolated altitude beyond which an update is sent")
+	exporterCmd.PersistentFlags().Float64Var(&deadReckoningAttitude, "dead-reckoning-attitude-threshold", 2, "Angle in degrees from the extrapolated roll, pitch or heading beyond which an update is sent")
+	exporterCmd.PersistentFlags().DurationVar(&deadReckoningMaxSilence, "dead-reckoning-max-silence", 10*time.Second, "Longest mission time for which an object's updates may be suppressed")
 	exporterCmd.PersistentFlags().BoolVar(&publishStdout, "publish-stdout", false, "Publish updates to stdout (useful for debugging)")
-	exporterCmd.PersistentFlags().StringVar(&publishToFolder, "publish-to-folder", "", "Publish updates as a new file in the given folder")
+	exporterCmd.PersistentFlags().StringVar(&stdoutFormat, "stdout-format", string(publishers.ACMIFormat), "Format of updates published to stdout (acmi, json)")
+	exporterCmd.PersistentFlags().StringVar(&publishToFolder, "publish-to-folder", "", "Publish updates as a new file in the given folder. A new file is always started when the mission changes or restarts")
+	exporterCmd.PersistentFlags().Int64Var(&rotateSize, "rotate-size", 0, "Start a new file after it reaches this many bytes (0 to disable). The size of compressed files is approximate, since data held by the compressor is counted once it is flushed every few seconds")
+	exporterCmd.PersistentFlags().DurationVar(&rotateDuration, "rotate-duration", 0, "Start a new file after this much wall-clock time (0 to disable)")
+	exporterCmd.PersistentFlags().DurationVar(&rotateMissionDuration, "rotate-mission-duration", 0, "Start a new file after this much mission time (0 to disable)")
+	exporterCmd.PersistentFlags().BoolVar(&resumeRecordings, "resume-recordings", true, "Continue the latest uncompressed file in the folder if it is a recording of the same mission, such as after the exporter restarts. Recordings of theatres unknown to the exporter are not resumed")
+	exporterCmd.PersistentFlags().BoolVar(&compressRecordings, "compress-recordings", false, "Write zip-compressed .zip.acmi files to the folder")
+	exporterCmd.PersistentFlags().IntVar(&publisherQueueSize, "publisher-queue-size", 0x10000, "Maximum number of frames queued for each publisher")
+	exporterCmd.PersistentFlags().StringVar(&adminAddress, "admin-address", "", "Address to serve the admin API on, for attaching, detaching and restarting publishers at runtime (disabled if empty). Anyone who can reach the API can open telemetry servers and write files, so a token is required unless the address is a loopback address")
+	exporterCmd.PersistentFlags().StringVar(&adminToken, "admin-token", "", "Bearer token which admin API requests must carry in the Authorization header")
+	exporterCmd.PersistentFlags().StringVar(&adminFolder, "admin-folder", "", "Folder within which file publishers attached through the admin API write. Relative folders are resolved against it (file publishers cannot be attached through the admin API if empty)")
+	exporterCmd.PersistentFlags().StringVar(&publisherOverflowPolicy, "publisher-overflow-policy", string(publishers.DropOldest), "What to do when a publisher's queue is full (drop-oldest, drop-newest, disconnect)")
 }
 
 func main() {
@@ -59,9 +140,37 @@ func main() {
 }
 
 func Run(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	// On SIGINT or SIGTERM, the context is cancelled and the recording is finished cleanly before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	wg := &sync.WaitGroup{}
 
+	if err := validateConfig(); err != nil {
+		return err
+	}
+	instances, err := buildPublishers()
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		log.Warn().Msg("no publishers are configured")
+	}
+	manager := publishers.NewManager()
+	for _, instance := range instances {
+		if err := manager.Attach(instance.name, instance.publisher, instance.queueSize, instance.overflowPolicy); err != nil {
+			return err
+		}
+	}
+	if adminAddress != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serveAdmin(ctx, adminAddress, adminToken, adminFolder, manager); err != nil {
+				log.Error().Err(err).Msg("admin server failed")
+			}
+		}()
+	}
+
 	log.Info().Str("address", grpcAddress).Msg("Connecting to gRPC server")
 	grpcClient, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -70,146 +179,223 @@ func Run(cmd *cobra.Command, args []string) error {
 	missionServiceClient := mission.NewMissionServiceClient(grpcClient)
 	coalitionServiceClient := coalition.NewCoalitionServiceClient(grpcClient)
 	hookServiceClient := hook.NewHookServiceClient(grpcClient)
+	customServiceClient := custom.NewCustomServiceClient(grpcClient)
+	worldServiceClient := world.NewWorldServiceClient(grpcClient)
 
-	dataStreamer := streamer.New(missionServiceClient, coalitionServiceClient, hookServiceClient)
+	dataStreamer := streamer.New(missionServiceClient, coalitionServiceClient, hookServiceClient, customServiceClient, worldServiceClient)
+	dataStreamer.SetCoalitionMapping(coalitionMapping)
+	dataStreamer.SetPrecision(streamer.Precision{
+		LongitudeLatitude: lonLatPrecision,
+		Altitude:          altitudePrecision,
+		Attitude:          attitudePrecision,
+		Native:            nativePrecision,
+	})
+	if adaptiveRates {
+		dataStreamer.EnableAdaptiveRates(streamer.AdaptiveRates{
+			TurnRateThreshold:     measure.Angle(adaptiveTurnRate) * measure.Degree,
+			AccelerationThreshold: measure.Acceleration(adaptiveAcceleration) * measure.MeterPerSecondSquared,
+			ProximityThreshold:    measure.Length(adaptiveProximity) * measure.Meter,
+			SlowInterval:          adaptiveSlowInterval,
+			Budget:                adaptiveBudget,
+		})
+	}
+	if deadReckoning {
+		dataStreamer.EnableDeadReckoning(streamer.DeadReckoning{
+			PositionThreshold: measure.Length(deadReckoningPosition) * measure.Meter,
+			AltitudeThreshold: measure.Length(deadReckoningAltitude) * measure.Meter,
+			AttitudeThreshold: measure.Angle(deadReckoningAttitude) * measure.Degree,
+			MaxSilence:        deadReckoningMaxSilence,
+		})
+	}
 
 	updates := make(chan streamer.Payload)
-	messages := make(chan string)
-	consumers := []chan string{}
-	consumersLock := sync.RWMutex{}
 
-	// TODO Reset when the mission changes or restarts
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dataStreamer.Stream(ctx, updates, airUnitUpdateInterval, surfaceUnitUpdateInterval, weaponUpdateInterval)
+	}()
+
+	var pending *streamer.Payload
+	for ctx.Err() == nil {
+		// Wait for the first update of the mission before starting a recording. This ignores repeated mission change
+		// signals and ensures the global properties are read from the new mission.
+		if pending == nil {
+			select {
+			case <-ctx.Done():
+			case update := <-updates:
+				if !update.MissionChanged {
+					pending = &update
+				}
+			}
+			continue
+		}
+		next, err := record(ctx, dataStreamer, manager, *pending, updates)
+		if err != nil {
+			// The mission is read again after a delay, so that a transient gRPC error does not end the exporter.
+			log.Error().Err(err).Dur("retryInterval", recordRetryInterval).Msg("failed to start recording, retrying")
+			select {
+			case <-ctx.Done():
+			case <-time.After(recordRetryInterval):
+			}
+			continue
+		}
+		pending = next
+	}
+
+	log.Info().Msg("shutting down")
+	wg.Wait()
+	manager.Close()
+	return nil
+}
+
+// missionTimeRewindThreshold is how far mission time must go backwards to be considered a mission restart.
+// Smaller regressions are expected because the unit streams are not synchronized with each other.
+const missionTimeRewindThreshold = 10 * time.Second
+
+// reorderTickInterval is how often held frames are checked to see whether they have been held for the reorder window.
+const reorderTickInterval = 100 * time.Millisecond
+
+// recordRetryInterval is how long to wait before starting a recording again after it failed to start.
+const recordRetryInterval = 5 * time.Second
+
+// missionReader reads the objects which are published at the start of a recording. It is implemented by
+// [streamer.Streamer].
+type missionReader interface {
+	GetGlobalObject(ctx context.Context) (*objects.Object, error)
+	GetBullseyes(ctx context.Context) ([]*objects.Object, error)
+	GetStaticObjects(ctx context.Context) ([]*objects.Update, error)
+}
+
+// record publishes a single recording of a mission, starting with the given update. It returns when the mission
+// changes or the context is cancelled. If the mission changed because mission time went backwards, the update which
+// revealed the change is returned so that it can begin the next recording.
+func record(ctx context.Context, dataStreamer missionReader, manager *publishers.Manager, first streamer.Payload, updates <-chan streamer.Payload) (*streamer.Payload, error) {
+	recordingCtx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	// The recording's goroutines are cancelled before they are waited on, so that a recording which ends because the
+	// mission changed does not wait forever.
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
 	log.Info().Msg("reading global properties")
 	globalObject, err := dataStreamer.GetGlobalObject(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get global object: %w", err)
+		return nil, fmt.Errorf("failed to get global object: %w", err)
 	}
 	log.Info().Msg("reading bullseyes")
 	bullseyes, err := dataStreamer.GetBullseyes(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get bullseyes: %w", err)
+		return nil, fmt.Errorf("failed to get bullseyes: %w", err)
 	}
 	initials := &publishers.Initials{
 		Global:    globalObject,
 		Bullseyes: bullseyes,
 	}
 
-	if publishStdout {
-		ch := make(chan string)
-		func() {
-			consumersLock.Lock()
-			defer consumersLock.Unlock()
-			consumers = append(consumers, ch)
-		}()
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			publisher := publishers.StdoutPublisher{}
-			if err := publisher.Publish(ctx, initials, ch); err != nil {
-				log.Error().Err(err).Msg("Failed to publish to stdout")
-			}
-		}()
+	log.Info().Msg("reading static objects")
+	statics, err := dataStreamer.GetStaticObjects(ctx)
+	if err != nil {
+		// Static objects are not needed to follow the mission, so the recording continues without them.
+		log.Warn().Err(err).Msg("failed to get static objects, recording without them")
+		statics = nil
 	}
 
-	if publishToFolder != "" {
-		folder, err := filepath.Abs(publishToFolder)
-		if err != nil {
-			return fmt.Errorf("failed to get absolute path to folder: %w", err)
-		}
-		if _, err := os.Stat(folder); os.IsNotExist(err) {
-			if err := os.MkdirAll(folder, 0755); err != nil {
-				return fmt.Errorf("failed to create folder: %w", err)
-			}
-		}
+	manager.Start(recordingCtx, initials)
+	defer manager.Stop()
 
-		title, err := dataStreamer.GetMissionName(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get mission name: %w", err)
-		}
-
-		publisher := publishers.FilePublisher{
-			Folder: folder,
-			Title:  title,
+	assembler := frames.NewAssembler(reorderWindow)
+	publish := func(ready []*frames.Frame) {
+		for _, frame := range ready {
+			manager.Publish(frame)
 		}
-
-		ch := make(chan string)
-		func() {
-			consumersLock.Lock()
-			defer consumersLock.Unlock()
-			consumers = append(consumers, ch)
-		}()
-
+	}
+	// Held frames are published before the recording ends.
+	defer func() {
+		publish(assembler.Flush())
+		log.Info().Uint64("corrected", assembler.Corrected()).Uint64("late", assembler.Late()).Msg("reordered late updates")
+	}()
+	ticker := time.NewTicker(reorderTickInterval)
+	defer ticker.Stop()
+	refreshed := make(chan []*objects.Update)
+	if globalRefreshInterval > 0 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := publisher.Publish(ctx, initials, ch); err != nil {
-				log.Error().Err(err).Msg("Failed to publish to folder")
-			}
+			refreshInitials(recordingCtx, dataStreamer, initials, globalRefreshInterval, refreshed)
 		}()
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		publisher := publishers.Server{
-			Address:  telemetryAddress,
-			Password: password,
+	// Static objects are published in the first frame rather than with the initials, so that airbase captures are
+	// tracked by the world state like any other change.
+	publish(assembler.Add(time.Now(), &frames.Frame{Time: first.MissionTime, Updates: statics}))
+
+	update := first
+	for {
+		if update.MissionChanged {
+			log.Info().Msg("mission changed, ending recording")
+			return nil, nil
 		}
-		ch := make(chan string)
-		func() {
-			consumersLock.Lock()
-			defer consumersLock.Unlock()
-			consumers = append(consumers, ch)
-		}()
-		if err := publisher.Publish(ctx, initials, ch); err != nil {
-			log.Error().Err(err).Msg("Failed to publish to server")
+		if update.MissionTime+missionTimeRewindThreshold < assembler.Newest() {
+			log.Info().Stringer("missionTime", update.MissionTime).Stringer("frameTime", assembler.Newest()).Msg("mission time went backwards, ending recording")
+			return &update, nil
 		}
-	}()
+		partial := &frames.Frame{Time: update.MissionTime}
+		if update.Update != nil {
+			partial.Updates = []*objects.Update{update.Update}
+		}
+		if update.Event != nil {
+			partial.Events = []*frames.Event{update.Event}
+		}
+		publish(assembler.Add(time.Now(), partial))
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for {
+		for received := false; !received; {
 			select {
 			case <-ctx.Done():
-				return
-			case message := <-messages:
-				func() {
-					consumersLock.RLock()
-					defer consumersLock.RUnlock()
-					for _, ch := range consumers {
-						ch <- message
-					}
-				}()
+				return nil, nil
+			case now := <-ticker.C:
+				publish(assembler.Ready(now))
+			case changed := <-refreshed:
+				publish(assembler.Add(time.Now(), &frames.Frame{Time: assembler.Newest(), Updates: changed}))
+			case update = <-updates:
+				received = true
 			}
 		}
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dataStreamer.Stream(ctx, updates, airUnitUpdateInterval, surfaceUnitUpdateInterval, weaponUpdateInterval)
-	}()
+	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		frameTime := time.Duration(0)
-		for {
+// refreshInitials reads the global properties and bullseyes at the given interval, and sends updates for those which
+// changed until the context is cancelled.
+func refreshInitials(ctx context.Context, dataStreamer missionReader, initials *publishers.Initials, interval time.Duration, refreshed chan<- []*objects.Update) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			globalObject, err := dataStreamer.GetGlobalObject(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to refresh global properties")
+				continue
+			}
+			bullseyes, err := dataStreamer.GetBullseyes(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to refresh bullseyes")
+				continue
+			}
+			changed := initials.Refresh(globalObject, bullseyes)
+			if len(changed) == 0 {
+				continue
+			}
+			log.Info().Int("objects", len(changed)).Msg("global properties or bullseyes changed")
 			select {
 			case <-ctx.Done():
 				return
-			case update := <-updates:
-				if update.MissionTime > frameTime {
-					frameTime = update.MissionTime
-					messages <- fmt.Sprintf("#%.2f", frameTime.Seconds())
-				}
-				messages <- update.Update.String()
+			case refreshed <- changed:
 			}
 		}
-	}()
-
-	<-ctx.Done()
-	wg.Wait()
-	return nil
+	}
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/dharmab/acmi-exporter/pkg/streamer"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMission counts how often the global properties are read.
+type fakeMission struct {
+	reads atomic.Int64
+	// staticsErr is returned when the static objects are read.
+	staticsErr error
+}
+
+func (m *fakeMission) GetGlobalObject(context.Context) (*objects.Object, error) {
+	m.reads.Add(1)
+	return &objects.Object{ID: 0, Properties: map[string]string{}}, nil
+}
+
+func (m *fakeMission) GetBullseyes(context.Context) ([]*objects.Object, error) {
+	return nil, nil
+}
+
+func (m *fakeMission) GetStaticObjects(context.Context) ([]*objects.Update, error) {
+	if m.staticsErr != nil {
+		return nil, m.staticsErr
+	}
+	return []*objects.Update{{ID: 0x100, Properties: map[string]string{"Name": "Bunker"}}}, nil
+}
+
+// framePublisher records the frames it receives.
+type framePublisher struct {
+	lock   sync.Mutex
+	frames []*frames.Frame
+}
+
+func (p *framePublisher) Publish(ctx context.Context, _ publishers.InitialsProvider, feed <-chan *frames.Frame) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame, ok := <-feed:
+			if !ok {
+				return nil
+			}
+			p.lock.Lock()
+			p.frames = append(p.frames, frame)
+			p.lock.Unlock()
+		}
+	}
+}
+
+// TestRecordMissionChange is not parallel because it sets the refresh interval and reorder window flags.
+func TestRecordMissionChange(t *testing.T) {
+	globalRefreshInterval = time.Millisecond
+	reorderWindow = 0
+	t.Cleanup(func() {
+		globalRefreshInterval = 30 * time.Second
+		reorderWindow = 2 * time.Second
+	})
+
+	mission := &fakeMission{}
+	publisher := &framePublisher{}
+	manager := publishers.NewManager()
+	require.NoError(t, manager.Attach("test", publisher, 16, publishers.DropOldest))
+
+	updates := make(chan streamer.Payload)
+	type result struct {
+		next *streamer.Payload
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		next, err := record(context.Background(), mission, manager, streamer.Payload{MissionTime: time.Second}, updates)
+		results <- result{next, err}
+	}()
+
+	// The refresh goroutine must be running when the mission changes.
+	require.Eventually(t, func() bool { return mission.reads.Load() > 2 }, time.Second, time.Millisecond)
+	updates <- streamer.Payload{MissionChanged: true}
+	select {
+	case r := <-results:
+		require.NoError(t, r.err)
+		assert.Nil(t, r.next)
+	case <-time.After(time.Second):
+		require.FailNow(t, "recording did not end when the mission changed")
+	}
+
+	reads := mission.reads.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, reads, mission.reads.Load(), "global properties were refreshed after the recording ended")
+
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+	require.NotEmpty(t, publisher.frames)
+	assert.Equal(t, uint64(0x100), publisher.frames[0].Updates[0].ID)
+}
+
+// TestRecordWithoutStatics is not parallel because it sets the reorder window flag.
+func TestRecordWithoutStatics(t *testing.T) {
+	reorderWindow = 0
+	t.Cleanup(func() {
+		reorderWindow = 2 * time.Second
+	})
+
+	mission := &fakeMission{staticsErr: errors.New("coalition service unavailable")}
+	publisher := &framePublisher{}
+	manager := publishers.NewManager()
+	require.NoError(t, manager.Attach("test", publisher, 16, publishers.DropOldest))
+
+	updates := make(chan streamer.Payload)
+	results := make(chan error, 1)
+	go func() {
+		_, err := record(context.Background(), mission, manager, streamer.Payload{MissionTime: time.Second}, updates)
+		results <- err
+	}()
+	updates <- streamer.Payload{
+		Update:      &objects.Update{ID: 0x200, Properties: map[string]string{"Name": "F-16C_50"}},
+		MissionTime: 2 * time.Second,
+	}
+
+	// The recording continues without static objects, so the unit is the only object published.
+	publishedIDs := func() []uint64 {
+		publisher.lock.Lock()
+		defer publisher.lock.Unlock()
+		var ids []uint64
+		for _, frame := range publisher.frames {
+			for _, update := range frame.Updates {
+				ids = append(ids, update.ID)
+			}
+		}
+		return ids
+	}
+	require.Eventually(t, func() bool { return len(publishedIDs()) > 0 }, time.Second, time.Millisecond)
+	updates <- streamer.Payload{MissionChanged: true}
+	require.NoError(t, <-results)
+	assert.Equal(t, []uint64{0x200}, publishedIDs())
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+)
+
+// publisherInstance is a named publisher and the settings for its queue.
+type publisherInstance struct {
+	name           string
+	publisher      publishers.Publisher
+	queueSize      int
+	overflowPolicy publishers.OverflowPolicy
+}
+
+// buildPublishers builds the publishers listed under the publishers key of the config file. If the key is not set,
+// the publishers are built from the publish-*, telemetry-* and rotate-* settings instead.
+//
+// Each entry under the publishers key is named by its key, and has a type which selects the publisher and
+// publisher-specific options. The queue-size and overflow-policy options override the corresponding global settings
+// for that publisher. For example:
+//
+//	publishers:
+//	  recorder:
+//	    type: file
+//	    folder: /var/lib/acmi-exporter
+//	  live:
+//	    type: server
+//	    address: 0.0.0.0:42675
+func buildPublishers() ([]publisherInstance, error) {
+	var instances []publisherInstance
+	var err error
+	if config != nil && config.IsSet("publishers") {
+		entries := config.GetStringMap("publishers")
+		// Publisher names and view passwords are read as written, since viper lower cases them.
+		if raw, ok := rawSetting("publishers"); ok {
+			entries, err = cast.ToStringMapE(raw)
+			if err != nil {
+				return nil, invalidSetting("publishers", err)
+			}
+		}
+		instances, err = buildConfiguredPublishers(entries)
+	} else {
+		instances, err = buildFlagPublishers()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return instances, checkDelayedPasswords(instances)
+}
+
+// checkDelayedPasswords returns an error if a password grants access to both a delayed and a live telemetry server,
+// since clients of the delayed server could then watch the live feed. A live server which needs no password is
+// already open to everyone, so it is not checked.
+func checkDelayedPasswords(instances []publisherInstance) error {
+	live := make(map[string]string)
+	for _, instance := range instances {
+		if server, ok := instance.publisher.(*publishers.Server); ok && server.Delay == 0 {
+			for _, p := range server.Passwords() {
+				if p != "" {
+					live[p] = instance.name
+				}
+			}
+		}
+	}
+	var errs []error
+	for _, instance := range instances {
+		if server, ok := instance.publisher.(*publishers.Server); ok && server.Delay > 0 {
+			for _, p := range server.Passwords() {
+				if name, ok := live[p]; ok {
+					errs = append(errs, fmt.Errorf("delayed publisher %q must not accept a password of live publisher %q", instance.name, name))
+					break
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func buildConfiguredPublishers(entries map[string]any) ([]publisherInstance, error) {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var errs []error
+	instances := make([]publisherInstance, 0, len(names))
+	for _, name := range names {
+		key := "publishers." + name
+		entry, err := cast.ToStringMapE(entries[name])
+		if err != nil {
+			errs = append(errs, invalidSetting(key, err))
+			continue
+		}
+		// Option names are matched regardless of case, like other settings. Their values, such as view passwords, keep
+		// their case.
+		options := make(map[string]any, len(entry))
+		for option, value := range entry {
+			options[strings.ToLower(option)] = value
+		}
+		instance, err := buildPublisher(name, options)
+		if err != nil {
+			errs = append(errs, invalidSetting(key, err))
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, errors.Join(errs...)
+}
+
+// buildFlagPublishers builds publishers from the individual settings.
+func buildFlagPublishers() ([]publisherInstance, error) {
+	var instances []publisherInstance
+	var errs []error
+	add := func(name string, options map[string]any) {
+		instance, err := buildPublisher(name, options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to build %s publisher: %w", name, err))
+			return
+		}
+		instances = append(instances, instance)
+	}
+
+	if publishStdout {
+		add("stdout", map[string]any{"type": "stdout", "format": stdoutFormat})
+	}
+	if publishToFolder != "" {
+		add("folder", map[string]any{
+			"type":                 "file",
+			"folder":               publishToFolder,
+			"compress":             compressRecordings,
+			"max-size":             rotateSize,
+			"max-duration":         rotateDuration,
+			"max-mission-duration": rotateMissionDuration,
+			"resume":               resumeRecordings,
+		})
+	}
+	server := func(address, password string, views map[string]string) map[string]any {
+		return map[string]any{
+			"type":               "server",
+			"address":            address,
+			"password":           password,
+			"views":              views,
+			"slow-client-policy": slowClientPolicy,
+		}
+	}
+	if telemetryAddress != "" {
+		add("server", server(telemetryAddress, password, telemetryViews))
+	}
+	if delayedTelemetryAddress != "" {
+		options := server(delayedTelemetryAddress, delayedPassword, delayedTelemetryViews)
+		options["delay"] = telemetryDelay
+		add("delayed server", options)
+	}
+	return instances, errors.Join(errs...)
+}
+
+// buildPublisher builds a single named publisher from its options.
+func buildPublisher(name string, options map[string]any) (publisherInstance, error) {
+	instance := publisherInstance{
+		name:           name,
+		queueSize:      publisherQueueSize,
+		overflowPolicy: publishers.OverflowPolicy(publisherOverflowPolicy),
+	}
+	// The common options are removed so that the remaining options can be checked for unknown keys.
+	options = maps.Clone(options)
+	kind, err := cast.ToStringE(options["type"])
+	if err != nil || kind == "" {
+		return instance, errors.New("type must be set")
+	}
+	delete(options, "type")
+	if value, ok := options["queue-size"]; ok {
+		instance.queueSize, err = cast.ToIntE(value)
+		if err != nil || instance.queueSize <= 0 {
+			return instance, fmt.Errorf("queue-size must be a positive integer, got %v", value)
+		}
+		delete(options, "queue-size")
+	}
+	if value, ok := options["overflow-policy"]; ok {
+		instance.overflowPolicy, err = publishers.ParseOverflowPolicy(cast.ToString(value))
+		if err != nil {
+			return instance, err
+		}
+		delete(options, "overflow-policy")
+	}
+
+	instance.publisher, err = publishers.Build(kind, func(target any) error {
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+			ErrorUnused:      true,
+			WeaklyTypedInput: true,
+			Result:           target,
+		})
+		if err != nil {
+			return err
+		}
+		return decoder.Decode(options)
+	})
+	return instance, err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDelayedPasswords(t *testing.T) {
+	t.Parallel()
+	server := func(name, password string, views map[string]publishers.View, delay time.Duration) publisherInstance {
+		return publisherInstance{name: name, publisher: &publishers.Server{Password: password, Views: views, Delay: delay}}
+	}
+
+	assert.NoError(t, checkDelayedPasswords([]publisherInstance{
+		server("live", "livepass", map[string]publishers.View{"blue": publishers.BlueView}, 0),
+		server("delayed", "delayedpass", map[string]publishers.View{"delayedblue": publishers.BlueView}, time.Minute),
+	}))
+	assert.NoError(t, checkDelayedPasswords([]publisherInstance{
+		server("live", "", nil, 0),
+		server("delayed", "", nil, time.Minute),
+	}), "servers which need no password may both be open")
+
+	assert.Error(t, checkDelayedPasswords([]publisherInstance{
+		server("live", "livepass", nil, 0),
+		server("delayed", "livepass", nil, time.Minute),
+	}))
+	assert.Error(t, checkDelayedPasswords([]publisherInstance{
+		server("live", "livepass", map[string]publishers.View{"blue": publishers.BlueView}, 0),
+		server("delayed", "delayedpass", map[string]publishers.View{"blue": publishers.RedView}, time.Minute),
+	}), "view passwords are checked too")
+}
+
+func TestConfiguredPublishersKeepCase(t *testing.T) {
+	loadTestConfig(t, "config.yaml", `
+publishers:
+  LiveServer:
+    Type: server
+    address: localhost:42675
+    password: SpectatorPW
+    views:
+      RedTeamPW: red
+  recorder:
+    type: file
+    folder: /var/lib/acmi-exporter
+`)
+	instances, err := buildPublishers()
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, "LiveServer", instances[0].name)
+	assert.Equal(t, "recorder", instances[1].name)
+	server, ok := instances[0].publisher.(*publishers.Server)
+	require.True(t, ok)
+	assert.Equal(t, "SpectatorPW", server.Password)
+	assert.Equal(t, map[string]publishers.View{"RedTeamPW": publishers.RedView}, server.Views)
+}
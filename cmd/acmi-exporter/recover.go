@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dharmab/acmi-exporter/pkg/publishers"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover FILE...",
+	Short: "Repair truncated ACMI recordings",
+	Long:  `Repair ACMI recordings which were truncated by a crash. The partial last line is trimmed and every remaining object is removed at the end of the recording. Each file is replaced in place.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  Recover,
+}
+
+func init() {
+	exporterCmd.AddCommand(recoverCmd)
+}
+
+func Recover(cmd *cobra.Command, args []string) error {
+	var errs []error
+	for _, path := range args {
+		if err := publishers.Recover(path); err != nil {
+			log.Error().Err(err).Str("path", path).Msg("failed to recover file")
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		log.Info().Str("path", path).Msg("recovered file")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package frames
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Assembler collects updates and events from several concurrent streams into frames with strictly increasing mission
+// times. Streams are not synchronized with each other, so an update may arrive after updates with a later mission time.
+// The assembler holds each frame for a reorder window so that late updates can be filed under their own mission time.
+//
+// A frame is released once mission time has advanced beyond it by the window, or once it has been held for the window
+// in wall-clock time, whichever is first. An update which arrives after its frame was released cannot be filed under
+// its own mission time, and is instead filed under the mission time of the last released frame. An Assembler is not
+// safe for concurrent use.
+type Assembler struct {
+	window time.Duration
+	// pending are the frames which have not been released, in mission time order.
+	pending []*pendingFrame
+	// newest is the latest mission time seen.
+	newest time.Duration
+	// released is true once a frame has been released. last is the mission time of the last released frame.
+	released  bool
+	last      time.Duration
+	corrected uint64
+	late      uint64
+}
+
+// pendingFrame is a frame held by an Assembler.
+type pendingFrame struct {
+	frame *Frame
+	// received is the wall-clock time at which the frame's first update was added.
+	received time.Time
+}
+
+// NewAssembler creates an Assembler with the given reorder window. A window of zero releases every frame as soon as
+// possible.
+func NewAssembler(window time.Duration) *Assembler {
+	return &Assembler{window: window}
+}
+
+// Add files the updates and events of a partial frame under its mission time, and returns the frames which are ready
+// to be released, in order. The partial frame is not modified.
+func (a *Assembler) Add(now time.Time, partial *Frame) []*Frame {
+	count := uint64(len(partial.Updates) + len(partial.Events))
+	if a.released && partial.Time <= a.last {
+		// The frame for this mission time was already released, so the partial frame is released on its own.
+		frame := &Frame{Time: a.last, Updates: partial.Updates, Events: partial.Events}
+		if partial.Time < a.last {
+			a.late += count
+		}
+		return append([]*Frame{frame}, a.Ready(now)...)
+	}
+
+	if partial.Time < a.newest {
+		a.corrected += count
+	}
+	a.newest = max(a.newest, partial.Time)
+	i, found := slices.BinarySearchFunc(a.pending, partial.Time, func(p *pendingFrame, t time.Duration) int {
+		return cmp.Compare(p.frame.Time, t)
+	})
+	if !found {
+		a.pending = slices.Insert(a.pending, i, &pendingFrame{frame: &Frame{Time: partial.Time}, received: now})
+	}
+	frame := a.pending[i].frame
+	frame.Updates = append(frame.Updates, partial.Updates...)
+	frame.Events = append(frame.Events, partial.Events...)
+	return a.Ready(now)
+}
+
+// Ready returns the frames which are ready to be released, in order.
+func (a *Assembler) Ready(now time.Time) []*Frame {
+	// If a frame is ready, every earlier frame is released with it so that mission time never goes backwards.
+	n := 0
+	for i, p := range a.pending {
+		if p.frame.Time <= a.newest-a.window || now.Sub(p.received) >= a.window {
+			n = i + 1
+		}
+	}
+	return a.release(n)
+}
+
+// Flush returns every held frame, in order.
+func (a *Assembler) Flush() []*Frame {
+	return a.release(len(a.pending))
+}
+
+// Newest returns the latest mission time seen.
+func (a *Assembler) Newest() time.Duration {
+	return a.newest
+}
+
+// Corrected returns the number of updates and events which arrived after a later mission time had been seen, and were
+// filed under their own mission time.
+func (a *Assembler) Corrected() uint64 {
+	return a.corrected
+}
+
+// Late returns the number of updates and events which arrived after their frame had been released, and were filed
+// under a later mission time.
+func (a *Assembler) Late() uint64 {
+	return a.late
+}
+
+// release removes and returns the first n held frames.
+func (a *Assembler) release(n int) []*Frame {
+	if n == 0 {
+		return nil
+	}
+	released := make([]*Frame, 0, n)
+	for _, p := range a.pending[:n] {
+		released = append(released, p.frame)
+	}
+	clear(a.pending[:n])
+	a.pending = a.pending[n:]
+	a.released = true
+	a.last = released[n-1].Time
+	return released
+}
@@ -0,0 +1,83 @@
+package frames
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func partialFrame(missionTime time.Duration, ids ...uint64) *Frame {
+	frame := &Frame{Time: missionTime}
+	for _, id := range ids {
+		frame.Updates = append(frame.Updates, &objects.Update{ID: id})
+	}
+	return frame
+}
+
+func updateIDs(frame *Frame) []uint64 {
+	ids := make([]uint64, 0, len(frame.Updates))
+	for _, update := range frame.Updates {
+		ids = append(ids, update.ID)
+	}
+	return ids
+}
+
+func TestAssemblerReordersLateUpdates(t *testing.T) {
+	t.Parallel()
+	a := NewAssembler(2 * time.Second)
+	now := time.Now()
+
+	assert.Empty(t, a.Add(now, partialFrame(1*time.Second, 0x1)))
+	assert.Empty(t, a.Add(now, partialFrame(2*time.Second, 0x2)))
+	// This update arrives after an update with a later mission time, but within the window.
+	assert.Empty(t, a.Add(now, partialFrame(1*time.Second, 0x3)))
+
+	ready := a.Add(now, partialFrame(3*time.Second, 0x4))
+	require.Len(t, ready, 1)
+	assert.Equal(t, time.Second, ready[0].Time)
+	assert.Equal(t, []uint64{0x1, 0x3}, updateIDs(ready[0]))
+	assert.Equal(t, uint64(1), a.Corrected())
+
+	// This update arrives after its frame was released, so it is filed under the last released frame.
+	ready = a.Add(now, partialFrame(0, 0x5))
+	require.Len(t, ready, 1)
+	assert.Equal(t, time.Second, ready[0].Time)
+	assert.Equal(t, uint64(1), a.Late())
+
+	ready = a.Flush()
+	require.Len(t, ready, 2)
+	assert.Equal(t, 2*time.Second, ready[0].Time)
+	assert.Equal(t, 3*time.Second, ready[1].Time)
+}
+
+func TestAssemblerReleasesHeldFramesAfterWindow(t *testing.T) {
+	t.Parallel()
+	a := NewAssembler(2 * time.Second)
+	now := time.Now()
+
+	assert.Empty(t, a.Add(now, partialFrame(1*time.Second, 0x1)))
+	assert.Empty(t, a.Add(now.Add(time.Second), partialFrame(2*time.Second, 0x2)))
+	assert.Empty(t, a.Ready(now.Add(time.Second)))
+
+	// The first frame has been held for the window in wall-clock time, even though mission time has not advanced.
+	ready := a.Ready(now.Add(2 * time.Second))
+	require.Len(t, ready, 1)
+	assert.Equal(t, time.Second, ready[0].Time)
+}
+
+func TestAssemblerWithoutWindow(t *testing.T) {
+	t.Parallel()
+	a := NewAssembler(0)
+	now := time.Now()
+
+	ready := a.Add(now, partialFrame(1*time.Second, 0x1))
+	require.Len(t, ready, 1)
+	ready = a.Add(now, partialFrame(1*time.Second, 0x2))
+	require.Len(t, ready, 1)
+	assert.Equal(t, time.Second, ready[0].Time)
+	assert.Zero(t, a.Late())
+	assert.Zero(t, a.Corrected())
+}
@@ -0,0 +1,130 @@
+package frames
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+)
+
+// DeltaEncoder removes unchanged data from frames. It caches the last known state of every object, so that each update
+// carries only the properties which changed, and each transform carries only the components which changed. ACMI
+// readers keep the previous value of anything which is omitted. A DeltaEncoder is not safe for concurrent use.
+type DeltaEncoder struct {
+	// started is true once a frame has been encoded. time is the mission time of the most recent frame.
+	started bool
+	time    time.Duration
+	// objects maps object IDs to their last known properties. Transforms are stored with every component.
+	objects map[uint64]map[string]string
+}
+
+// NewDeltaEncoder creates a DeltaEncoder with no known objects.
+func NewDeltaEncoder() *DeltaEncoder {
+	return &DeltaEncoder{objects: make(map[uint64]map[string]string)}
+}
+
+// Encode returns a copy of the frame which omits unchanged data. Updates which change nothing are dropped. The given
+// frame is not modified.
+func (e *DeltaEncoder) Encode(frame *Frame) *Frame {
+	e.started = true
+	e.time = frame.Time
+	encoded := &Frame{Time: frame.Time, Events: frame.Events}
+	for _, update := range frame.Updates {
+		if delta, ok := e.encodeUpdate(update); ok {
+			encoded.Updates = append(encoded.Updates, delta)
+		}
+	}
+	return encoded
+}
+
+func (e *DeltaEncoder) encodeUpdate(update *objects.Update) (*objects.Update, bool) {
+	if update.IsRemoval {
+		if _, ok := e.objects[update.ID]; !ok {
+			return nil, false
+		}
+		delete(e.objects, update.ID)
+		return update, true
+	}
+
+	known, ok := e.objects[update.ID]
+	if !ok {
+		e.objects[update.ID] = maps.Clone(update.Properties)
+		return update, true
+	}
+	delta := &objects.Update{ID: update.ID, Properties: make(map[string]string)}
+	for key, value := range update.Properties {
+		previous, ok := known[key]
+		if key == properties.Transform && ok {
+			known[key] = MergeTransform(previous, value)
+			if sparse := SparseTransform(previous, value); sparse != "" {
+				delta.Properties[key] = sparse
+			}
+			continue
+		}
+		if ok && previous == value {
+			continue
+		}
+		known[key] = value
+		delta.Properties[key] = value
+	}
+	if len(delta.Properties) == 0 {
+		return nil, false
+	}
+	return delta, true
+}
+
+// Snapshot returns a frame at the current mission time which sets every property of every known object, in ID order.
+// Returns nil if no frame has been encoded.
+func (e *DeltaEncoder) Snapshot() *Frame {
+	if !e.started {
+		return nil
+	}
+	ids := slices.Sorted(maps.Keys(e.objects))
+	snapshot := &Frame{Time: e.time, Updates: make([]*objects.Update, 0, len(ids))}
+	for _, id := range ids {
+		snapshot.Updates = append(snapshot.Updates, &objects.Update{ID: id, Properties: maps.Clone(e.objects[id])})
+	}
+	return snapshot
+}
+
+// SparseTransform returns a transform which changes a transform from previous to next, with every unchanged component
+// left empty. Returns an empty string if nothing changed. If the transforms have different numbers of components, next
+// is returned unchanged.
+func SparseTransform(previous, next string) string {
+	previousFields := strings.Split(previous, "|")
+	nextFields := strings.Split(next, "|")
+	if len(previousFields) != len(nextFields) {
+		return next
+	}
+	changed := false
+	for i, field := range nextFields {
+		if field == previousFields[i] {
+			nextFields[i] = ""
+		} else if field != "" {
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(nextFields, "|")
+}
+
+// MergeTransform returns the transform which results from applying next, which may be sparse, to previous. If the
+// transforms have different numbers of components, next is returned unchanged.
+func MergeTransform(previous, next string) string {
+	previousFields := strings.Split(previous, "|")
+	nextFields := strings.Split(next, "|")
+	if len(previousFields) != len(nextFields) {
+		return next
+	}
+	for i, field := range nextFields {
+		if field == "" {
+			nextFields[i] = previousFields[i]
+		}
+	}
+	return strings.Join(nextFields, "|")
+}
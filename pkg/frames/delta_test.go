@@ -0,0 +1,53 @@
+package frames
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaEncoderOmitsUnchangedData(t *testing.T) {
+	t.Parallel()
+	e := NewDeltaEncoder()
+	update := func(transform, name string) *objects.Update {
+		return &objects.Update{ID: 0x1a, Properties: map[string]string{
+			properties.Transform: transform,
+			properties.Name:      name,
+			properties.Color:     "Blue",
+		}}
+	}
+
+	first := e.Encode(&Frame{Time: time.Second, Updates: []*objects.Update{update("1|2|3", "F-16C_50")}})
+	require.Len(t, first.Updates, 1)
+	assert.Len(t, first.Updates[0].Properties, 3)
+
+	second := e.Encode(&Frame{Time: 2 * time.Second, Updates: []*objects.Update{update("1|2|4", "F-16C_50")}})
+	require.Len(t, second.Updates, 1)
+	assert.Equal(t, map[string]string{properties.Transform: "||4"}, second.Updates[0].Properties)
+
+	third := e.Encode(&Frame{Time: 3 * time.Second, Updates: []*objects.Update{update("1|2|4", "F-16C_50")}})
+	assert.Empty(t, third.Updates)
+
+	snapshot := e.Snapshot()
+	require.NotNil(t, snapshot)
+	assert.Equal(t, 3*time.Second, snapshot.Time)
+	require.Len(t, snapshot.Updates, 1)
+	assert.Equal(t, "1|2|4", snapshot.Updates[0].Properties[properties.Transform])
+	assert.Equal(t, "F-16C_50", snapshot.Updates[0].Properties[properties.Name])
+
+	removed := e.Encode(&Frame{Time: 4 * time.Second, Updates: []*objects.Update{{ID: 0x1a, IsRemoval: true}}})
+	assert.Len(t, removed.Updates, 1)
+	assert.Empty(t, e.Snapshot().Updates)
+}
+
+func TestSparseTransform(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "||3000", SparseTransform("1|2|2000", "1|2|3000"))
+	assert.Equal(t, "", SparseTransform("1|2|3000", "1|2|3000"))
+	assert.Equal(t, "1|2|3|4|5", SparseTransform("1|2|3", "1|2|3|4|5"))
+	assert.Equal(t, "1|2|3000", MergeTransform("1|2|2000", "||3000"))
+}
@@ -0,0 +1,114 @@
+// Package frames models the changes to a recording which flow from the streamer to the publishers.
+package frames
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties/events"
+)
+
+// Frame is a set of changes to a recording at a single mission time.
+type Frame struct {
+	// Time is the mission time at which the changes occurred.
+	Time time.Duration
+	// Updates are object updates and removals. Updates to the global object change global properties. Property values
+	// are encoded as in ACMI.
+	Updates []*objects.Update
+	// Events are notable events, such as a unit being destroyed.
+	Events []*Event
+}
+
+// Event is a notable event which involves zero or more objects.
+type Event struct {
+	// Type of the event.
+	Type events.Event
+	// ObjectIDs are the IDs of the objects involved in the event. The first object is the subject of the event.
+	ObjectIDs []uint64
+	// Text describes the event.
+	Text string
+	// Mentions are the spans of Text which name objects, in order.
+	Mentions []Mention
+}
+
+// Mention is a span of an event's text which names an object.
+type Mention struct {
+	// ObjectID is the ID of the named object.
+	ObjectID uint64
+	// Start and End are the byte offsets of the name within the text.
+	Start int
+	End   int
+}
+
+// hiddenName replaces the names of objects which cannot be seen.
+const hiddenName = "unknown"
+
+// Redact returns the event as seen by a client which can only see the objects for which visible returns true. Hidden
+// objects are omitted from the object IDs and their names are replaced in the text. If the subject is hidden, the event
+// becomes a message, so that it is not attributed to another object. Returns false if the event involves objects and
+// none of them are visible. The event is not modified.
+func (e *Event) Redact(visible func(id uint64) bool) (*Event, bool) {
+	if len(e.ObjectIDs) == 0 && len(e.Mentions) == 0 {
+		return e, true
+	}
+	redacted := &Event{Type: e.Type}
+	for _, id := range e.ObjectIDs {
+		if visible(id) {
+			redacted.ObjectIDs = append(redacted.ObjectIDs, id)
+		}
+	}
+	if len(e.ObjectIDs) > 0 {
+		if len(redacted.ObjectIDs) == 0 {
+			return nil, false
+		}
+		if !visible(e.ObjectIDs[0]) {
+			redacted.Type = events.Message
+		}
+	}
+
+	var text strings.Builder
+	last := 0
+	for _, mention := range e.Mentions {
+		text.WriteString(e.Text[last:mention.Start])
+		last = mention.End
+		start := text.Len()
+		if !visible(mention.ObjectID) {
+			text.WriteString(hiddenName)
+			continue
+		}
+		text.WriteString(e.Text[mention.Start:mention.End])
+		redacted.Mentions = append(redacted.Mentions, Mention{ObjectID: mention.ObjectID, Start: start, End: text.Len()})
+	}
+	text.WriteString(e.Text[last:])
+	redacted.Text = text.String()
+	return redacted, true
+}
+
+// String encodes the event as the value of the ACMI Event property.
+func (e *Event) String() string {
+	fields := make([]string, 0, len(e.ObjectIDs)+2)
+	fields = append(fields, string(e.Type))
+	for _, id := range e.ObjectIDs {
+		fields = append(fields, strconv.FormatUint(id, 16))
+	}
+	fields = append(fields, Escape(e.Text))
+	return strings.Join(fields, "|")
+}
+
+// escaper escapes characters which have special meaning within an ACMI property value.
+var escaper = strings.NewReplacer(",", `\,`, "\n", `\`+"\n")
+
+// Escape escapes a string for use within an ACMI property value.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// unescaper reverses the escaping of commas and newlines in ACMI property values.
+var unescaper = strings.NewReplacer(`\,`, ",", `\`+"\n", "\n")
+
+// Unescape reverses Escape.
+func Unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,58 @@
+package frames
+
+import (
+	"testing"
+
+	"github.com/dharmab/goacmi/properties/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRedact(t *testing.T) {
+	t.Parallel()
+	event := &Event{
+		Type:      events.Destroyed,
+		ObjectIDs: []uint64{0x2b, 0x1a},
+		Text:      "Viper (F-16C_50) destroyed Flanker (Su-27) with AIM-120C",
+		Mentions: []Mention{
+			{ObjectID: 0x1a, Start: 0, End: 16},
+			{ObjectID: 0x2b, Start: 27, End: 42},
+			{ObjectID: 0x3c, Start: 48, End: 56},
+		},
+	}
+	visibleIDs := func(ids ...uint64) func(uint64) bool {
+		return func(id uint64) bool {
+			for _, visible := range ids {
+				if id == visible {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	redacted, ok := event.Redact(visibleIDs(0x1a, 0x2b, 0x3c))
+	require.True(t, ok)
+	assert.Equal(t, event, redacted)
+
+	redacted, ok = event.Redact(visibleIDs(0x1a, 0x3c))
+	require.True(t, ok)
+	assert.Equal(t, events.Message, redacted.Type, "an event whose subject is hidden is not attributed to another object")
+	assert.Equal(t, []uint64{0x1a}, redacted.ObjectIDs)
+	assert.Equal(t, "Viper (F-16C_50) destroyed unknown with AIM-120C", redacted.Text)
+	assert.Equal(t, []Mention{{ObjectID: 0x1a, Start: 0, End: 16}, {ObjectID: 0x3c, Start: 40, End: 48}}, redacted.Mentions)
+
+	redacted, ok = event.Redact(visibleIDs(0x2b))
+	require.True(t, ok)
+	assert.Equal(t, events.Destroyed, redacted.Type)
+	assert.Equal(t, []uint64{0x2b}, redacted.ObjectIDs)
+	assert.Equal(t, "unknown destroyed Flanker (Su-27) with unknown", redacted.Text)
+
+	_, ok = event.Redact(visibleIDs(0x3c))
+	assert.False(t, ok, "an event is hidden if none of its objects are visible")
+
+	message := &Event{Type: events.Message, Text: "Mission started"}
+	redacted, ok = message.Redact(visibleIDs())
+	require.True(t, ok)
+	assert.Equal(t, message, redacted)
+}
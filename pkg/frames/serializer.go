@@ -0,0 +1,156 @@
+package frames
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+)
+
+// Serializer encodes frames for an output. A serializer may keep state between frames, so each output must use its own
+// serializer.
+type Serializer interface {
+	// Initial encodes the initial state of the recording, which is written before the first frame.
+	Initial(updates []*objects.Update) []byte
+	// Frame encodes a frame.
+	Frame(frame *Frame) []byte
+}
+
+// ACMISerializer encodes frames as ACMI text. A time frame line is written only when the mission time changes.
+type ACMISerializer struct {
+	started bool
+	time    time.Duration
+}
+
+var _ Serializer = &ACMISerializer{}
+
+// NewACMISerializer creates an ACMISerializer.
+func NewACMISerializer() *ACMISerializer {
+	return &ACMISerializer{}
+}
+
+// Initial implements [Serializer.Initial].
+func (s *ACMISerializer) Initial(updates []*objects.Update) []byte {
+	var b strings.Builder
+	for _, update := range updates {
+		b.WriteString(update.String())
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// Frame implements [Serializer.Frame].
+func (s *ACMISerializer) Frame(frame *Frame) []byte {
+	var b strings.Builder
+	for _, line := range s.Lines(frame) {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// Lines encodes a frame as ACMI lines.
+func (s *ACMISerializer) Lines(frame *Frame) []string {
+	lines := make([]string, 0, len(frame.Updates)+len(frame.Events)+1)
+	if !s.started || frame.Time != s.time {
+		s.started = true
+		s.time = frame.Time
+		lines = append(lines, TimeFrame(frame.Time))
+	}
+	for _, update := range frame.Updates {
+		lines = append(lines, update.String())
+	}
+	for _, event := range frame.Events {
+		lines = append(lines, EventLine(event))
+	}
+	return lines
+}
+
+// TimeFrame encodes a mission time as an ACMI time frame line.
+func TimeFrame(t time.Duration) string {
+	return fmt.Sprintf("#%.2f", t.Seconds())
+}
+
+// EventLine encodes an event as an ACMI line which sets the Event property of the global object.
+func EventLine(event *Event) string {
+	update := objects.Update{
+		ID:         objects.GlobalObjectID,
+		Properties: map[string]string{EventProperty: event.String()},
+	}
+	return update.String()
+}
+
+// Header is the header which begins every ACMI text recording.
+const Header = "FileType=text/acmi/tacview\nFileVersion=2.2"
+
+// EventProperty is the global object property used to record events in ACMI.
+const EventProperty = "Event"
+
+// JSONSerializer encodes frames as JSON Lines, one JSON object per frame.
+type JSONSerializer struct{}
+
+var _ Serializer = &JSONSerializer{}
+
+type jsonUpdate struct {
+	ID         string            `json:"id"`
+	Removal    bool              `json:"removal,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type jsonEvent struct {
+	Type      string   `json:"type"`
+	ObjectIDs []string `json:"objectIds,omitempty"`
+	Text      string   `json:"text"`
+}
+
+type jsonFrame struct {
+	Time    *float64     `json:"time,omitempty"`
+	Updates []jsonUpdate `json:"updates,omitempty"`
+	Events  []jsonEvent  `json:"events,omitempty"`
+}
+
+// Initial implements [Serializer.Initial]. The initial state is encoded as a frame without a time.
+func (s *JSONSerializer) Initial(updates []*objects.Update) []byte {
+	return s.encode(jsonFrame{Updates: toJSONUpdates(updates)})
+}
+
+// Frame implements [Serializer.Frame].
+func (s *JSONSerializer) Frame(frame *Frame) []byte {
+	seconds := frame.Time.Seconds()
+	encoded := jsonFrame{
+		Time:    &seconds,
+		Updates: toJSONUpdates(frame.Updates),
+	}
+	for _, event := range frame.Events {
+		ids := make([]string, 0, len(event.ObjectIDs))
+		for _, id := range event.ObjectIDs {
+			ids = append(ids, strconv.FormatUint(id, 16))
+		}
+		encoded.Events = append(encoded.Events, jsonEvent{Type: string(event.Type), ObjectIDs: ids, Text: event.Text})
+	}
+	return s.encode(encoded)
+}
+
+func (s *JSONSerializer) encode(frame jsonFrame) []byte {
+	b, err := json.Marshal(frame)
+	if err != nil {
+		// The frame contains only strings, numbers and booleans, so this cannot happen.
+		panic(err)
+	}
+	return append(b, '\n')
+}
+
+func toJSONUpdates(updates []*objects.Update) []jsonUpdate {
+	result := make([]jsonUpdate, 0, len(updates))
+	for _, update := range updates {
+		result = append(result, jsonUpdate{
+			ID:         strconv.FormatUint(update.ID, 16),
+			Removal:    update.IsRemoval,
+			Properties: update.Properties,
+		})
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package publishers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+)
+
+// delayedItem is a server item which is held back until it is due.
+type delayedItem struct {
+	item serverItem
+	due  time.Time
+}
+
+// delayItems returns a channel which receives each item from the given channel after the given delay, in order. Items
+// are buffered without limit while they are held back. When the done channel is closed, every held item is sent without
+// further delay and the returned channel is closed.
+func delayItems(done <-chan struct{}, items <-chan serverItem, delay time.Duration) <-chan serverItem {
+	delayed := make(chan serverItem)
+	go func() {
+		defer close(delayed)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		var queue []delayedItem
+		for {
+			var send chan<- serverItem
+			var next serverItem
+			var wait <-chan time.Time
+			if len(queue) > 0 {
+				if remaining := time.Until(queue[0].due); remaining > 0 {
+					timer.Reset(remaining)
+					wait = timer.C
+				} else {
+					send = delayed
+					next = queue[0].item
+				}
+			}
+
+			select {
+			case <-done:
+				for _, held := range queue {
+					delayed <- held.item
+				}
+				return
+			case item := <-items:
+				queue = append(queue, delayedItem{item: item, due: time.Now().Add(delay)})
+			case send <- next:
+				queue[0] = delayedItem{}
+				queue = queue[1:]
+			case <-wait:
+			}
+		}
+	}()
+	return delayed
+}
+
+// fixedInitials is an [InitialsProvider] which keeps returning the first initials it read. Changes to the initials
+// reach a delayed feed as updates in its frames, so a delayed server must not send them to new clients any earlier.
+type fixedInitials struct {
+	provider InitialsProvider
+	lock     sync.Mutex
+	updates  []*objects.Update
+}
+
+// fixInitials reads the initials from the provider immediately, and returns a provider which keeps returning them.
+func fixInitials(provider InitialsProvider) *fixedInitials {
+	fixed := &fixedInitials{provider: provider}
+	_, _ = fixed.Get()
+	return fixed
+}
+
+// Get implements [InitialsProvider.Get]. The provider is read until it succeeds.
+func (i *fixedInitials) Get() ([]*objects.Update, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.updates != nil {
+		return i.updates, nil
+	}
+	updates, err := i.provider.Get()
+	if err != nil {
+		return updates, err
+	}
+	i.updates = updates
+	return updates, nil
+}
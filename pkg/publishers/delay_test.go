@@ -0,0 +1,111 @@
+package publishers
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayItems(t *testing.T) {
+	t.Parallel()
+	done := make(chan struct{})
+	defer close(done)
+
+	items := make(chan serverItem)
+	delay := 100 * time.Millisecond
+	delayed := delayItems(done, items, delay)
+
+	first := serverItem{frame: testFrame(time.Second, "1a,T=1|2|3")}
+	restart := serverItem{initials: staticInitials{"0,Title=Test"}}
+	second := serverItem{frame: testFrame(2*time.Second, "1a,T=4|5|6")}
+	start := time.Now()
+	items <- first
+	items <- restart
+	items <- second
+
+	received := make([]serverItem, 0, 3)
+	for range 3 {
+		received = append(received, <-delayed)
+	}
+	require.Equal(t, []serverItem{first, restart, second}, received)
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+}
+
+func TestDelayItemsFlushesWhenDone(t *testing.T) {
+	t.Parallel()
+	done := make(chan struct{})
+
+	items := make(chan serverItem)
+	delayed := delayItems(done, items, time.Hour)
+	held := serverItem{frame: testFrame(time.Second)}
+	items <- held
+	close(done)
+
+	select {
+	case item := <-delayed:
+		assert.Equal(t, held, item)
+	case <-time.After(5 * time.Second):
+		t.Fatal("held item was not sent")
+	}
+	_, ok := <-delayed
+	assert.False(t, ok)
+}
+
+func TestDelayedServerSendsHeldFramesWhenClosed(t *testing.T) {
+	t.Parallel()
+	s := &Server{Address: "127.0.0.1:0", Delay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed := make(chan *frames.Frame)
+	go func() {
+		_ = s.Publish(ctx, staticInitials{"0,Title=Test"}, feed)
+	}()
+
+	conn, err := net.Dial("tcp", listening(t, s))
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := connect(t, conn, "")
+	assert.Equal(t, []string{"0,Title=Test"}, readLines(t, reader, 1))
+
+	feed <- testFrame(time.Second, "1a,Name=F-16C_50")
+	// The server has queued the first frame once it receives the second, which writes nothing.
+	feed <- testFrame(time.Second)
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"#1.00", "1a,Name=F-16C_50"}, readLines(t, reader, 2))
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestFixedInitials(t *testing.T) {
+	t.Parallel()
+	global := &objects.Object{ID: objects.GlobalObjectID, Properties: map[string]string{}}
+	for _, name := range []string{
+		properties.ReferenceTime,
+		properties.RecordingTime,
+		properties.Title,
+		properties.DataRecorder,
+		properties.DataSource,
+		properties.ReferenceLongitude,
+		properties.ReferenceLatitude,
+	} {
+		global.Properties[name] = "0"
+	}
+	bullseye := func(transform string) []*objects.Object {
+		return []*objects.Object{{ID: 0x40000001, Properties: map[string]string{properties.Transform: transform}}}
+	}
+	initials := &Initials{Global: global, Bullseyes: bullseye("1|2|0")}
+
+	fixed := fixInitials(initials)
+	initials.Refresh(global, bullseye("3|4|0"))
+	updates, err := fixed.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "1|2|0", updates[len(updates)-1].Properties[properties.Transform], "later changes reach delayed clients through the feed")
+}
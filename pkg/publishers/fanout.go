@@ -0,0 +1,225 @@
+package publishers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+)
+
+// OverflowPolicy determines what happens when a frame is published to a subscription whose queue is full.
+type OverflowPolicy string
+
+const (
+	// DropOldest discards the oldest queued frame to make room for the new frame. Whole frames are discarded,
+	// including their time, events and removals. If the Fanout has a snapshot source, the subscription is then
+	// resynchronized.
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest discards the new frame. If the Fanout has a snapshot source, the subscription is then resynchronized
+	// once its queue has room.
+	DropNewest OverflowPolicy = "drop-newest"
+	// Disconnect closes the subscription and removes it from the Fanout. The subscriber receives no further frames.
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+// ParseOverflowPolicy parses an overflow policy from its name.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(s); p {
+	case DropOldest, DropNewest, Disconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q", s)
+}
+
+// Fanout copies each published frame to every subscription. Publishing never blocks, so a slow subscriber cannot
+// delay the others.
+//
+// Frames may be delta encoded, so a subscriber which misses a frame may also miss a change which is never repeated. If
+// the Fanout has a snapshot source, a subscription which discarded a frame is resynchronized: the next frame published
+// to it is replaced by a snapshot at that frame's time, which removes every object that was removed in a discarded
+// frame and sets every property of every object, and carries that frame's events.
+type Fanout struct {
+	subscriptions []*Subscription
+	lock          sync.RWMutex
+	// snapshot returns a frame which sets every property of every object as of the most recently published frame. It
+	// is nil if subscriptions are not resynchronized.
+	snapshot func() *frames.Frame
+}
+
+// NewFanout creates a Fanout with no subscriptions.
+func NewFanout() *Fanout {
+	return &Fanout{}
+}
+
+// Subscribe creates a subscription with a queue which holds up to size frames. The policy determines what happens
+// when the queue is full.
+func (f *Fanout) Subscribe(name string, size int, policy OverflowPolicy) *Subscription {
+	return f.subscribe(name, size, policy, nil)
+}
+
+// subscribe creates a subscription whose queue initially holds the given backlog, followed by up to size frames.
+func (f *Fanout) subscribe(name string, size int, policy OverflowPolicy, backlog []*frames.Frame) *Subscription {
+	subscription := &Subscription{
+		Name:   name,
+		queue:  make(chan *frames.Frame, size+len(backlog)),
+		policy: policy,
+	}
+	for _, frame := range backlog {
+		subscription.queue <- frame
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subscriptions = append(f.subscriptions, subscription)
+	return subscription
+}
+
+// Unsubscribe removes a subscription and closes it. The subscriber receives any frames which are already queued,
+// and then no further frames.
+func (f *Fanout) Unsubscribe(subscription *Subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subscriptions = slices.DeleteFunc(f.subscriptions, func(s *Subscription) bool {
+		return s == subscription
+	})
+	if !subscription.closed.Swap(true) {
+		close(subscription.queue)
+	}
+}
+
+// Subscriptions returns every open subscription.
+func (f *Fanout) Subscriptions() []*Subscription {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	subscriptions := make([]*Subscription, len(f.subscriptions))
+	copy(subscriptions, f.subscriptions)
+	return subscriptions
+}
+
+// Publish copies the frame to every subscription without blocking.
+func (f *Fanout) Publish(frame *frames.Frame) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	// The snapshot is only taken if a subscription needs it, and is shared by every such subscription.
+	var snapshot *frames.Frame
+	var snapshotIDs map[uint64]struct{}
+	for _, subscription := range f.subscriptions {
+		if !subscription.dirty || f.snapshot == nil || !subscription.hasRoom() {
+			subscription.offer(frame)
+			continue
+		}
+		if snapshot == nil {
+			snapshot = f.snapshot()
+			snapshotIDs = make(map[uint64]struct{}, len(snapshot.Updates))
+			for _, update := range snapshot.Updates {
+				snapshotIDs[update.ID] = struct{}{}
+			}
+		}
+		subscription.offer(subscription.resync(frame, snapshot, snapshotIDs))
+	}
+	// Subscriptions which were disconnected receive no further frames.
+	f.subscriptions = slices.DeleteFunc(f.subscriptions, (*Subscription).IsClosed)
+}
+
+// Subscription is a bounded queue of frames for a single subscriber.
+type Subscription struct {
+	// Name identifies the subscriber in logs.
+	Name    string
+	queue   chan *frames.Frame
+	policy  OverflowPolicy
+	dropped atomic.Uint64
+	closed  atomic.Bool
+	// dirty is true if a frame was discarded since the subscription was last resynchronized. lost holds the IDs of
+	// objects which were removed in the discarded frames. Both are guarded by the Fanout's lock.
+	dirty bool
+	lost  map[uint64]struct{}
+}
+
+// Frames returns the channel from which the subscriber receives frames. The channel is closed if the subscription is
+// disconnected.
+func (s *Subscription) Frames() <-chan *frames.Frame {
+	return s.queue
+}
+
+// Dropped returns the number of frames which were discarded because the queue was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// IsClosed returns true if the subscription was disconnected.
+func (s *Subscription) IsClosed() bool {
+	return s.closed.Load()
+}
+
+// offer adds the frame to the queue, applying the overflow policy if the queue is full. It must only be called by
+// Fanout.Publish, which holds the Fanout's lock to guarantee a single sender.
+func (s *Subscription) offer(frame *frames.Frame) {
+	if s.closed.Load() {
+		s.dropped.Add(1)
+		return
+	}
+	for {
+		select {
+		case s.queue <- frame:
+			return
+		default:
+		}
+		switch s.policy {
+		case DropNewest:
+			s.discard(frame)
+			return
+		case Disconnect:
+			s.dropped.Add(1)
+			s.closed.Store(true)
+			close(s.queue)
+			return
+		default:
+			// Discard the oldest frame and try again. The subscriber may have drained the queue in the meantime,
+			// in which case nothing is discarded.
+			select {
+			case oldest := <-s.queue:
+				s.discard(oldest)
+			default:
+			}
+		}
+	}
+}
+
+// discard counts a frame which the subscriber will not receive, and records what must be resynchronized.
+func (s *Subscription) discard(frame *frames.Frame) {
+	s.dropped.Add(1)
+	s.dirty = true
+	for _, update := range frame.Updates {
+		if update.IsRemoval {
+			if s.lost == nil {
+				s.lost = make(map[uint64]struct{})
+			}
+			s.lost[update.ID] = struct{}{}
+		}
+	}
+}
+
+// hasRoom returns true if a frame offered to the subscription would be queued. Only the drop-newest policy discards
+// the offered frame when the queue is full.
+func (s *Subscription) hasRoom() bool {
+	return s.policy != DropNewest || len(s.queue) < cap(s.queue)
+}
+
+// resync returns a frame which replaces the given frame for a subscription which discarded frames. It removes every
+// object which was removed in a discarded frame and is not in the snapshot, and then sets every object in the snapshot.
+func (s *Subscription) resync(frame, snapshot *frames.Frame, snapshotIDs map[uint64]struct{}) *frames.Frame {
+	resync := &frames.Frame{Time: frame.Time, Events: frame.Events}
+	for _, id := range slices.Sorted(maps.Keys(s.lost)) {
+		if _, ok := snapshotIDs[id]; !ok {
+			resync.Updates = append(resync.Updates, &objects.Update{ID: id, IsRemoval: true})
+		}
+	}
+	resync.Updates = append(resync.Updates, snapshot.Updates...)
+	// If this frame is also discarded, its removals are recorded again.
+	s.dirty = false
+	s.lost = nil
+	return resync
+}
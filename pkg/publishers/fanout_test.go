@@ -0,0 +1,122 @@
+package publishers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishTimes publishes one frame at each of the given times in seconds.
+func publishTimes(fanout *Fanout, times ...int) {
+	for _, t := range times {
+		fanout.Publish(&frames.Frame{Time: time.Duration(t) * time.Second})
+	}
+}
+
+// queuedTimes returns the times in seconds of the frames queued in a subscription, without waiting for more.
+func queuedTimes(subscription *Subscription) []int {
+	var times []int
+	for {
+		select {
+		case frame, ok := <-subscription.Frames():
+			if !ok {
+				return times
+			}
+			times = append(times, int(frame.Time/time.Second))
+		default:
+			return times
+		}
+	}
+}
+
+func TestFanoutDropOldest(t *testing.T) {
+	t.Parallel()
+	fanout := NewFanout()
+	subscription := fanout.Subscribe("test", 2, DropOldest)
+	publishTimes(fanout, 1, 2, 3, 4)
+	assert.Equal(t, []int{3, 4}, queuedTimes(subscription))
+	assert.Equal(t, uint64(2), subscription.Dropped())
+	assert.False(t, subscription.IsClosed())
+}
+
+func TestFanoutDropNewest(t *testing.T) {
+	t.Parallel()
+	fanout := NewFanout()
+	subscription := fanout.Subscribe("test", 2, DropNewest)
+	publishTimes(fanout, 1, 2, 3, 4)
+	assert.Equal(t, []int{1, 2}, queuedTimes(subscription))
+	assert.Equal(t, uint64(2), subscription.Dropped())
+	assert.False(t, subscription.IsClosed())
+}
+
+func TestFanoutDisconnect(t *testing.T) {
+	t.Parallel()
+	fanout := NewFanout()
+	subscription := fanout.Subscribe("test", 2, Disconnect)
+	other := fanout.Subscribe("other", 4, Disconnect)
+	publishTimes(fanout, 1, 2, 3, 4)
+	assert.True(t, subscription.IsClosed())
+	assert.Equal(t, []int{1, 2}, queuedTimes(subscription), "frames queued before the disconnect are delivered")
+	_, ok := <-subscription.Frames()
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), subscription.Dropped())
+	assert.Equal(t, []*Subscription{other}, fanout.Subscriptions(), "a disconnected subscription is removed")
+
+	assert.False(t, other.IsClosed())
+	assert.Equal(t, []int{1, 2, 3, 4}, queuedTimes(other))
+	assert.Zero(t, other.Dropped())
+}
+
+func TestFanoutUnsubscribe(t *testing.T) {
+	t.Parallel()
+	fanout := NewFanout()
+	subscription := fanout.Subscribe("test", 4, DropOldest)
+	publishTimes(fanout, 1)
+	fanout.Unsubscribe(subscription)
+	publishTimes(fanout, 2)
+	assert.Equal(t, []int{1}, queuedTimes(subscription))
+	assert.True(t, subscription.IsClosed())
+	assert.Empty(t, fanout.Subscriptions())
+
+	// Unsubscribing twice does not close the queue twice.
+	assert.NotPanics(t, func() { fanout.Unsubscribe(subscription) })
+}
+
+func TestFanoutUnsubscribeWhilePublishing(t *testing.T) {
+	t.Parallel()
+	fanout := NewFanout()
+	subscriptions := make([]*Subscription, 0, 8)
+	for _, policy := range []OverflowPolicy{DropOldest, DropNewest, Disconnect, DropOldest, DropNewest, Disconnect, DropOldest, DropNewest} {
+		subscriptions = append(subscriptions, fanout.Subscribe(string(policy), 4, policy))
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			publishTimes(fanout, i)
+		}
+	}()
+	for _, subscription := range subscriptions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range subscription.Frames() {
+			}
+		}()
+	}
+	for _, subscription := range subscriptions {
+		fanout.Unsubscribe(subscription)
+	}
+	wg.Wait()
+
+	require.Empty(t, fanout.Subscriptions())
+	for _, subscription := range subscriptions {
+		assert.True(t, subscription.IsClosed())
+	}
+}
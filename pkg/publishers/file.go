@@ -1,60 +1,405 @@
 package publishers
 
 import (
+	"archive/zip"
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// FilePublisher publishes ACMI messages to a file.
+// FilePublisher publishes frames to an ACMI file.
 type FilePublisher struct {
-	// Folder where the file will be saved.
-	Folder string
-	// Title of the mission.
-	Title string
+	// Folder where the file will be saved. It is created if it does not exist.
+	Folder string `mapstructure:"folder"`
+	// Title of the mission. Defaults to the Title global property from the initials.
+	Title string `mapstructure:"title"`
+	// Compress writes a zip-compressed .zip.acmi file instead of a plain text .acmi file.
+	Compress bool `mapstructure:"compress"`
+	// MaxSize is the size in bytes after which a new file is started. Zero disables size-based rotation. The size of a
+	// compressed file is approximate: data held by the compressor is only counted once it is flushed, which happens
+	// at least every syncInterval, so a compressed file may exceed MaxSize by the compressed size of that much data.
+	MaxSize int64 `mapstructure:"max-size"`
+	// MaxDuration is the wall-clock duration after which a new file is started. Zero disables wall-clock rotation.
+	MaxDuration time.Duration `mapstructure:"max-duration"`
+	// MaxMissionDuration is the mission-time duration after which a new file is started. Zero disables mission-time
+	// rotation.
+	MaxMissionDuration time.Duration `mapstructure:"max-mission-duration"`
+	// Resume continues the most recent uncompressed recording in the folder, rather than starting a new file, if it has
+	// the same title, reference time and reference point as the initials and the mission time has not gone backwards
+	// since it was written. Recordings of unknown theatres are not resumed, because their reference point is chosen
+	// from the first object seen.
+	Resume bool `mapstructure:"resume"`
 }
 
 var _ Publisher = &FilePublisher{}
 
-// Publish implements [Publisher.Publish] by writing messages to a file. The file is created in the FilePublisher's folder, and is named using the FilePublisher's title and the current date and time.
-func (p *FilePublisher) Publish(ctx context.Context, initials InitialsProvider, messages <-chan string) error {
-	path := fmt.Sprintf("%s/%s %s.acmi", p.Folder, p.Title, time.Now().Format("2006-01-02-150405"))
-	logger := log.With().Str("path", path).Logger()
-	logger.Info().Msg("creating file")
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
+func init() {
+	Register("file", func(decode Decoder) (Publisher, error) {
+		p := &FilePublisher{}
+		if err := decode(p); err != nil {
+			return nil, err
+		}
+		if p.Folder == "" {
+			return nil, errors.New("folder must not be empty")
+		}
+		if p.MaxSize < 0 || p.MaxDuration < 0 || p.MaxMissionDuration < 0 {
+			return nil, errors.New("rotation limits must not be negative")
+		}
+		return p, nil
+	})
+}
+
+const (
+	// fileBufferSize is the size of the write buffer for each file.
+	fileBufferSize = 0x10000
+	// syncInterval is how often buffered data is flushed and synced to disk, bounding how much of a recording is lost
+	// if the process crashes.
+	syncInterval = 5 * time.Second
+)
 
-	logger.Info().Msg("writing file headers")
-	if _, err := file.WriteString("FileType=text/acmi/tacview\nFileVersion=2.2\n"); err != nil {
-		return fmt.Errorf("failed to write header to file: %w", err)
+// Publish implements [Publisher.Publish] by writing frames to a file. The file is created in the FilePublisher's folder, and is named using the FilePublisher's title and the current date and time.
+// If Compress is set, the frames are streamed into a single entry of a zip archive, which is finalized when the
+// context is cancelled or the feed is closed.
+//
+// If a rotation limit is reached, a new file is started at the next change of mission time. Each new file begins with
+// the ACMI header, the initials and a snapshot of the world state, so that it can be opened on its own.
+//
+// When the context is cancelled, frames which are already queued are written before the file is closed. Every file
+// ends with a removal for each remaining object, and is flushed and synced to disk when it is closed.
+func (p *FilePublisher) Publish(ctx context.Context, initials InitialsProvider, feed <-chan *frames.Frame) (err error) {
+	if err := os.MkdirAll(p.Folder, 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	if p.Title == "" {
+		title, err := initialTitle(initials)
+		if err != nil {
+			return err
+		}
+		// The publisher may be reused for other recordings, so the title is set on a copy.
+		withTitle := *p
+		withTitle.Title = title
+		p = &withTitle
 	}
 
-	logger.Info().Msg("writing data to file")
-	initialLines, err := initials.Get()
-	if err != nil {
-		return fmt.Errorf("failed to get initials: %w", err)
+	state := newWorldState()
+	var r *recording
+	var candidate *resumable
+	if p.Resume && !p.Compress {
+		candidate, err = p.findResumable(initials)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to find recording to resume")
+		}
 	}
-	for _, line := range initialLines {
-		if _, err := file.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("failed to write initial line to file: %w", err)
+	// If there is a recording to resume, the file is opened when the first frame arrives, once it is known whether the
+	// mission time has gone backwards.
+	if candidate == nil {
+		r, err = p.create(initials, 1, nil)
+		if err != nil {
+			return err
 		}
 	}
+	defer func() {
+		if r == nil {
+			return
+		}
+		if closeErr := r.close(state.removals(SpectatorView)); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
 
+	write := func(frame *frames.Frame) error {
+		if r == nil {
+			var err error
+			if frame.Time >= candidate.lastFrame {
+				r, err = p.resume(candidate, initials)
+			} else {
+				log.Info().Str("path", candidate.path).Msg("mission time went backwards, not resuming file")
+				r, err = p.create(initials, 1, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if r.startTime >= 0 && frame.Time != r.time && p.shouldRotate(r, frame.Time) {
+			r.logger.Info().Msg("rotating file")
+			// The removals are written before the frame is applied, so they close the previous frame.
+			if err := r.close(state.removals(SpectatorView)); err != nil {
+				return err
+			}
+			// The snapshot is taken at the new mission time, so the new file does not begin in the past.
+			snapshot := state.snapshot(SpectatorView)
+			if snapshot != nil {
+				snapshot.Time = frame.Time
+			}
+			next, err := p.create(initials, r.sequence+1, snapshot)
+			if err != nil {
+				return err
+			}
+			r = next
+		}
+		state.apply(frame)
+		if r.startTime < 0 {
+			r.startTime = frame.Time
+		}
+		if err := r.writeFrame(frame); err != nil {
+			return fmt.Errorf("failed to write frame to file: %w", err)
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case message := <-messages:
-			line := message + "\n"
-			if _, err := file.WriteString(line); err != nil {
-				return fmt.Errorf("failed to write message to file: %w", err)
+			// The recording is not open yet if it is to be resumed and no frame has arrived.
+			if r != nil {
+				r.logger.Info().Msg("draining queued frames")
+			}
+			for {
+				select {
+				case frame, ok := <-feed:
+					if !ok {
+						return nil
+					}
+					if err := write(frame); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		case frame, ok := <-feed:
+			if !ok {
+				return feedClosed(ctx)
+			}
+			if err := write(frame); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if r == nil {
+				continue
+			}
+			if err := r.sync(); err != nil {
+				return err
 			}
 		}
 	}
 }
+
+// shouldRotate returns true if any of the rotation limits has been reached by the given recording at the given mission
+// time.
+func (p *FilePublisher) shouldRotate(r *recording, missionTime time.Duration) bool {
+	if p.MaxSize > 0 && r.written() >= p.MaxSize {
+		return true
+	}
+	if p.MaxDuration > 0 && time.Since(r.created) >= p.MaxDuration {
+		return true
+	}
+	if p.MaxMissionDuration > 0 && r.startTime >= 0 && missionTime-r.startTime >= p.MaxMissionDuration {
+		return true
+	}
+	return false
+}
+
+// create starts a new file and writes the ACMI header, the initials and the given snapshot, if any, to it. Files after
+// the first are numbered with the given sequence number.
+func (p *FilePublisher) create(initials InitialsProvider, sequence int, snapshot *frames.Frame) (*recording, error) {
+	now := time.Now()
+	name := fmt.Sprintf("%s %s", p.Title, now.Format("2006-01-02-150405"))
+	if sequence > 1 {
+		name = fmt.Sprintf("%s (%d)", name, sequence)
+	}
+	extension := ".acmi"
+	if p.Compress {
+		extension = ".zip.acmi"
+	}
+	path := fmt.Sprintf("%s/%s%s", p.Folder, name, extension)
+
+	r := &recording{
+		sequence:   sequence,
+		created:    now,
+		startTime:  -1,
+		serializer: frames.NewACMISerializer(),
+		logger:     log.With().Str("path", path).Logger(),
+	}
+	r.logger.Info().Msg("creating file")
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	r.file = file
+	r.buffer = bufio.NewWriterSize(&countingWriter{writer: file, count: &r.size}, fileBufferSize)
+	r.writer = r.buffer
+
+	if p.Compress {
+		r.archive = zip.NewWriter(r.buffer)
+		// Tacview names the entry in its own compressed recordings with a .txt.acmi extension.
+		entry := name + ".txt.acmi"
+		r.writer, err = r.archive.CreateHeader(&zip.FileHeader{Name: entry, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to create archive entry: %w", err)
+		}
+	}
+
+	r.logger.Info().Msg("writing file headers")
+	if err := r.writeLine(frames.Header); err != nil {
+		r.close(nil)
+		return nil, fmt.Errorf("failed to write header to file: %w", err)
+	}
+
+	r.logger.Info().Msg("writing data to file")
+	initialUpdates, err := initials.Get()
+	if err != nil {
+		r.close(nil)
+		return nil, fmt.Errorf("failed to get initials: %w", err)
+	}
+	if _, err := r.writer.Write(r.serializer.Initial(initialUpdates)); err != nil {
+		r.close(nil)
+		return nil, fmt.Errorf("failed to write initials to file: %w", err)
+	}
+	if snapshot != nil {
+		r.startTime = snapshot.Time
+		if err := r.writeFrame(snapshot); err != nil {
+			r.close(nil)
+			return nil, fmt.Errorf("failed to write snapshot to file: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// recording is a single file written by a FilePublisher.
+type recording struct {
+	// sequence is the position of the file among the files written by the publisher, starting at 1.
+	sequence int
+	file     *os.File
+	// buffer buffers writes to the file.
+	buffer *bufio.Writer
+	// archive is the zip archive wrapping the buffer, or nil if the file is not compressed.
+	archive *zip.Writer
+	writer  io.Writer
+	// size is the number of bytes flushed to the file. See written.
+	size int64
+	// created is the wall-clock time at which the file was created.
+	created time.Time
+	// startTime is the mission time of the first frame in the file, or negative if no frame has been written.
+	startTime time.Duration
+	// time is the mission time of the last frame written to the file.
+	time       time.Duration
+	serializer *frames.ACMISerializer
+	logger     zerolog.Logger
+}
+
+// written returns the number of bytes written to the file, including bytes which are still buffered. Data held by the
+// compressor of a compressed file is not counted.
+func (r *recording) written() int64 {
+	return r.size + int64(r.buffer.Buffered())
+}
+
+// writeFrame writes a frame to the file.
+func (r *recording) writeFrame(frame *frames.Frame) error {
+	r.time = frame.Time
+	_, err := r.writer.Write(r.serializer.Frame(frame))
+	return err
+}
+
+// writeLine writes a single line to the file.
+func (r *recording) writeLine(line string) error {
+	_, err := io.WriteString(r.writer, line+"\n")
+	return err
+}
+
+// sync flushes buffered data and syncs the file to disk. Data held by the compressor of a compressed file is not
+// flushed until the file is closed.
+func (r *recording) sync() error {
+	if r.archive != nil {
+		if err := r.archive.Flush(); err != nil {
+			return fmt.Errorf("failed to flush archive: %w", err)
+		}
+	}
+	if err := r.buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return nil
+}
+
+// close writes the given closing updates, finalizes the archive, if any, and flushes, syncs and closes the file.
+func (r *recording) close(closing []*objects.Update) error {
+	defer r.file.Close()
+	for _, update := range closing {
+		if err := r.writeLine(update.String()); err != nil {
+			return fmt.Errorf("failed to write closing line to file: %w", err)
+		}
+	}
+	if r.archive != nil {
+		// The archive's central directory is written on close, so it must be closed before the file.
+		if err := r.archive.Close(); err != nil {
+			return fmt.Errorf("failed to finalize archive: %w", err)
+		}
+	}
+	if err := r.buffer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	r.logger.Info().Msg("closed file")
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	*w.count += int64(n)
+	return n, err
+}
+
+// initialTitle returns the unescaped Title global property from the initials.
+func initialTitle(initials InitialsProvider) (string, error) {
+	initialUpdates, err := initials.Get()
+	if err != nil {
+		return "", fmt.Errorf("failed to get initials: %w", err)
+	}
+	title, ok := globalProperties(initialUpdates)[properties.Title]
+	if !ok {
+		return "", errors.New("initials have no title")
+	}
+	return frames.Unescape(title), nil
+}
+
+// parseFrame parses the mission time from a time frame line.
+func parseFrame(line string) (time.Duration, bool) {
+	s, ok := strings.CutPrefix(line, "#")
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
@@ -0,0 +1,210 @@
+package publishers
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePublisherCompressed(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	publisher := FilePublisher{Folder: folder, Title: "Test", Compress: true}
+
+	feed := make(chan *frames.Frame, 1)
+	feed <- testFrame(time.Second, "1a,T=1|2|3", "1a,Name=F-16C_50")
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), staticInitials{"0,Title=Test"}, feed), ErrFeedClosed)
+
+	paths, err := filepath.Glob(filepath.Join(folder, "*.zip.acmi"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+
+	info, err := os.Stat(paths[0])
+	require.NoError(t, err)
+	archive, err := zip.NewReader(mustOpen(t, paths[0]), info.Size())
+	require.NoError(t, err)
+	require.Len(t, archive.File, 1)
+	assert.True(t, strings.HasSuffix(archive.File[0].Name, ".txt.acmi"))
+
+	entry, err := archive.File[0].Open()
+	require.NoError(t, err)
+	defer entry.Close()
+	content, err := io.ReadAll(entry)
+	require.NoError(t, err)
+	assert.Equal(t, "FileType=text/acmi/tacview\nFileVersion=2.2\n0,Title=Test\n#1.00\n1a,T=1|2|3\n1a,Name=F-16C_50\n-1a,\n", string(content))
+}
+
+// mustOpen opens a file which is closed when the test ends.
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	return file
+}
+
+func TestFilePublisherRotatesBySize(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	publisher := FilePublisher{Folder: folder, Title: "Test", MaxSize: 1}
+
+	feed := make(chan *frames.Frame, 3)
+	feed <- testFrame(time.Second, "1a,T=1|2|3", "1a,Name=F-16C_50")
+	feed <- testFrame(2*time.Second, "1a,T=4|5|6")
+	feed <- testFrame(2*time.Second, "1a,T=7|8|9")
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), staticInitials{"0,Title=Test"}, feed), ErrFeedClosed)
+
+	paths, err := filepath.Glob(filepath.Join(folder, "*.acmi"))
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	contents := make(map[string]string)
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		contents[filepath.Base(path)] = string(b)
+	}
+
+	header := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,Title=Test\n"
+	var first, second string
+	for name, content := range contents {
+		assert.True(t, strings.HasPrefix(content, header), name)
+		assert.Contains(t, content, "\n#", "%s holds no frame", name)
+		if strings.Contains(name, "(2)") {
+			second = content
+		} else {
+			first = content
+		}
+	}
+	// Frames at the same mission time are never split between files.
+	assert.Equal(t, header+"#1.00\n1a,T=1|2|3\n1a,Name=F-16C_50\n-1a,\n", first)
+	// A rotated file begins with a snapshot of the world state at the mission time which triggered the rotation.
+	assert.True(t, strings.HasPrefix(second, header+"#2.00\n1a,"))
+	assert.Contains(t, second, "Name=F-16C_50")
+	// Each file ends with a removal for every remaining object.
+	assert.True(t, strings.HasSuffix(second, "\n1a,T=4|5|6\n1a,T=7|8|9\n-1a,\n"))
+}
+
+func TestFilePublisherRotatesCompressedBySize(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	publisher := FilePublisher{Folder: folder, Title: "Test", Compress: true, MaxSize: 1}
+
+	feed := make(chan *frames.Frame, 3)
+	feed <- testFrame(time.Second, "1a,T=1|2|3", "1a,Name=F-16C_50")
+	feed <- testFrame(2*time.Second, "1a,T=4|5|6")
+	feed <- testFrame(3*time.Second, "1a,T=7|8|9")
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), staticInitials{"0,Title=Test"}, feed), ErrFeedClosed)
+
+	paths, err := filepath.Glob(filepath.Join(folder, "*.zip.acmi"))
+	require.NoError(t, err)
+	require.Len(t, paths, 3)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		archive, err := zip.NewReader(mustOpen(t, path), info.Size())
+		require.NoError(t, err)
+		require.Len(t, archive.File, 1)
+		entry, err := archive.File[0].Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(entry)
+		entry.Close()
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "\n#", "%s holds no frame", filepath.Base(path))
+		assert.Contains(t, string(content), "Name=F-16C_50", "%s does not begin with the world state", filepath.Base(path))
+	}
+}
+
+func TestFilePublisherResumes(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	initials := staticInitials{"0,ReferenceTime=2024-06-01T12:00:00Z", "0,Title=Test"}
+	header := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,ReferenceTime=2024-06-01T12:00:00Z\n0,Title=Test\n"
+	// The exporter crashed while writing this file, leaving a partial last line and an object which was never removed.
+	path := filepath.Join(folder, "Test 2024-06-01-120000.acmi")
+	require.NoError(t, os.WriteFile(path, []byte(header+"#1.00\n1a,T=1|2|3,Name=F-16C_50\n#2.00\n1a,T=4|"), 0o644))
+
+	publisher := FilePublisher{Folder: folder, Title: "Test", Resume: true}
+	feed := make(chan *frames.Frame, 1)
+	feed <- testFrame(5*time.Second, "2b,T=7|8|9", "2b,Name=Su-27")
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), initials, feed), ErrFeedClosed)
+
+	paths, err := filepath.Glob(filepath.Join(folder, "*.acmi"))
+	require.NoError(t, err)
+	require.Equal(t, []string{path}, paths)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, header+"#1.00\n1a,T=1|2|3,Name=F-16C_50\n#2.00\n-1a,\n#5.00\n2b,T=7|8|9\n2b,Name=Su-27\n-2b,\n", string(content))
+}
+
+func TestFilePublisherDoesNotResumeAfterRestart(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	initials := staticInitials{"0,ReferenceTime=2024-06-01T12:00:00Z", "0,Title=Test"}
+	path := filepath.Join(folder, "Test 2024-06-01-120000.acmi")
+	original := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,ReferenceTime=2024-06-01T12:00:00Z\n0,Title=Test\n#10.00\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o644))
+
+	publisher := FilePublisher{Folder: folder, Title: "Test", Resume: true}
+	feed := make(chan *frames.Frame, 1)
+	feed <- testFrame(time.Second)
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), initials, feed), ErrFeedClosed)
+
+	paths, err := filepath.Glob(filepath.Join(folder, "*.acmi"))
+	require.NoError(t, err)
+	assert.Len(t, paths, 2)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+}
+
+func TestFilePublisherResumeKeepsInitials(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	initials := staticInitials{"0,ReferenceTime=2024-06-01T12:00:00Z", "0,Title=Test", "40000001,T=1|2|0"}
+	header := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,ReferenceTime=2024-06-01T12:00:00Z\n0,Title=Test\n40000001,T=1|2|0\n"
+	path := filepath.Join(folder, "Test 2024-06-01-120000.acmi")
+	require.NoError(t, os.WriteFile(path, []byte(header+"#1.00\n1a,T=1|2|3,Name=F-16C_50\n"), 0o644))
+
+	publisher := FilePublisher{Folder: folder, Title: "Test", Resume: true}
+	feed := make(chan *frames.Frame, 1)
+	feed <- testFrame(5 * time.Second)
+	close(feed)
+	require.ErrorIs(t, publisher.Publish(context.Background(), initials, feed), ErrFeedClosed)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, header+"#1.00\n1a,T=1|2|3,Name=F-16C_50\n-1a,\n40000001,T=1|2|0\n#5.00\n", string(content))
+}
+
+func TestFilePublisherStopsBeforeResuming(t *testing.T) {
+	t.Parallel()
+	folder := t.TempDir()
+	initials := staticInitials{"0,ReferenceTime=2024-06-01T12:00:00Z", "0,Title=Test"}
+	path := filepath.Join(folder, "Test 2024-06-01-120000.acmi")
+	original := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,ReferenceTime=2024-06-01T12:00:00Z\n0,Title=Test\n#10.00\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0o644))
+
+	// The context is cancelled before the first frame arrives, so the recording is never opened.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	publisher := FilePublisher{Folder: folder, Title: "Test", Resume: true}
+	require.NoError(t, publisher.Publish(ctx, initials, make(chan *frames.Frame)))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+}
@@ -0,0 +1,278 @@
+package publishers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/rs/zerolog/log"
+)
+
+// Manager runs a set of named publishers, each fed by its own subscription to a [Fanout]. Publishers may be attached,
+// detached and restarted at any time. A publisher which starts partway through a recording first receives a snapshot
+// of the world state.
+//
+// Frames are delta encoded before they are published, so publishers receive only the data which changed. A publisher
+// whose queue overflows is resynchronized from a snapshot of the encoder's state.
+type Manager struct {
+	// adminLock serializes changes to the set of publishers and to the recording, so that a publisher is never started
+	// and stopped concurrently.
+	adminLock sync.Mutex
+	// lock guards the fields below. It is held while publishing, so that a snapshot taken under it is consistent with
+	// the frames which follow it.
+	lock    sync.Mutex
+	entries map[string]*managedPublisher
+	// active is true while a recording is in progress.
+	active   bool
+	ctx      context.Context
+	initials InitialsProvider
+	encoder  *frames.DeltaEncoder
+	fanout   *Fanout
+}
+
+// managedPublisher is a publisher attached to a Manager.
+type managedPublisher struct {
+	name      string
+	publisher Publisher
+	queueSize int
+	policy    OverflowPolicy
+	// The fields below are set while the publisher runs during a recording.
+	subscription *Subscription
+	cancel       context.CancelFunc
+	// done is closed when the publisher returns. err is set before done is closed.
+	done chan struct{}
+	err  error
+}
+
+// PublisherStatus describes a publisher attached to a Manager.
+type PublisherStatus struct {
+	Name string `json:"name"`
+	// Running is true if the publisher is publishing the current recording.
+	Running bool `json:"running"`
+	// Error is the error returned by the publisher when it last stopped, if any.
+	Error string `json:"error,omitempty"`
+	// Dropped is the number of frames the publisher has missed during the current recording.
+	Dropped uint64 `json:"dropped"`
+}
+
+// NewManager creates a Manager with no publishers.
+func NewManager() *Manager {
+	return &Manager{entries: make(map[string]*managedPublisher)}
+}
+
+// Attach adds a publisher with a queue of the given size and overflow policy. If a recording is in progress, the
+// publisher starts immediately.
+func (m *Manager) Attach(name string, publisher Publisher, queueSize int, policy OverflowPolicy) error {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.entries[name]; ok {
+		return fmt.Errorf("publisher %q is already attached", name)
+	}
+	entry := &managedPublisher{
+		name:      name,
+		publisher: publisher,
+		queueSize: queueSize,
+		policy:    policy,
+	}
+	m.entries[name] = entry
+	log.Info().Str("publisher", name).Msg("attached publisher")
+	if m.active {
+		m.start(entry)
+	}
+	return nil
+}
+
+// Detach stops and removes a publisher, and closes it if it implements [io.Closer].
+func (m *Manager) Detach(name string) error {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	entry, ok := m.entries[name]
+	if !ok {
+		m.lock.Unlock()
+		return fmt.Errorf("publisher %q is not attached", name)
+	}
+	delete(m.entries, name)
+	done := m.stop(entry)
+	m.lock.Unlock()
+
+	<-done
+	closePublisher(entry)
+	log.Info().Str("publisher", name).Msg("detached publisher")
+	return nil
+}
+
+// Restart stops a publisher, if it is running, and starts it again if a recording is in progress. This recovers a
+// publisher which failed.
+func (m *Manager) Restart(name string) error {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	entry, ok := m.entries[name]
+	if !ok {
+		m.lock.Unlock()
+		return fmt.Errorf("publisher %q is not attached", name)
+	}
+	done := m.stop(entry)
+	m.lock.Unlock()
+
+	<-done
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	log.Info().Str("publisher", name).Msg("restarting publisher")
+	if m.active {
+		m.start(entry)
+	}
+	return nil
+}
+
+// Statuses returns the status of every attached publisher, ordered by name.
+func (m *Manager) Statuses() []PublisherStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	statuses := make([]PublisherStatus, 0, len(m.entries))
+	for _, entry := range m.entries {
+		status := PublisherStatus{Name: entry.name}
+		if entry.done != nil {
+			select {
+			case <-entry.done:
+				if entry.err != nil {
+					status.Error = entry.err.Error()
+				}
+			default:
+				status.Running = true
+			}
+		}
+		if entry.subscription != nil {
+			status.Dropped = entry.subscription.Dropped()
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b PublisherStatus) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return statuses
+}
+
+// Start begins a recording. Every attached publisher is started with the given initials. The recording ends when the
+// context is cancelled or Stop is called.
+func (m *Manager) Start(ctx context.Context, initials InitialsProvider) {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.active = true
+	m.ctx = ctx
+	m.initials = initials
+	m.encoder = frames.NewDeltaEncoder()
+	m.fanout = NewFanout()
+	// Subscriptions which fall behind are resynchronized from the encoder, since they may have missed changes which
+	// the encoder will not send again.
+	m.fanout.snapshot = m.encoder.Snapshot
+	for _, entry := range m.entries {
+		m.start(entry)
+	}
+}
+
+// Stop ends the recording and waits for every publisher to finish.
+func (m *Manager) Stop() {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	m.active = false
+	var pending []<-chan struct{}
+	for _, entry := range m.entries {
+		if entry.subscription != nil {
+			if dropped := entry.subscription.Dropped(); dropped > 0 {
+				log.Warn().Str("publisher", entry.name).Uint64("dropped", dropped).Msg("publisher fell behind and frames were dropped")
+			}
+		}
+		pending = append(pending, m.stop(entry))
+	}
+	m.lock.Unlock()
+
+	for _, done := range pending {
+		<-done
+	}
+}
+
+// Close closes every attached publisher which implements [io.Closer], such as a server which keeps its clients
+// connected between recordings. It must be called after the last recording has stopped.
+func (m *Manager) Close() {
+	m.adminLock.Lock()
+	defer m.adminLock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, entry := range m.entries {
+		closePublisher(entry)
+	}
+}
+
+// closePublisher closes a publisher which implements [io.Closer]. A failure is logged, since the publisher is no longer
+// needed.
+func closePublisher(entry *managedPublisher) {
+	closer, ok := entry.publisher.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Warn().Err(err).Str("publisher", entry.name).Msg("failed to close publisher")
+	}
+}
+
+// Publish delta encodes a frame and sends it to every running publisher without blocking. Frames published while no
+// recording is in progress are discarded. The frame must not be modified after it is published.
+func (m *Manager) Publish(frame *frames.Frame) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.active {
+		return
+	}
+	m.fanout.Publish(m.encoder.Encode(frame))
+}
+
+// start runs a publisher for the current recording. The publisher's queue begins with a snapshot of the world state.
+// It must be called with the lock held.
+func (m *Manager) start(entry *managedPublisher) {
+	var backlog []*frames.Frame
+	if snapshot := m.encoder.Snapshot(); snapshot != nil {
+		backlog = append(backlog, snapshot)
+	}
+	entry.subscription = m.fanout.subscribe(entry.name, entry.queueSize, entry.policy, backlog)
+	ctx, cancel := context.WithCancel(m.ctx)
+	entry.cancel = cancel
+	done := make(chan struct{})
+	entry.done = done
+	entry.err = nil
+	subscription := entry.subscription
+	initials := m.initials
+	go func() {
+		defer close(done)
+		err := entry.publisher.Publish(ctx, initials, subscription.Frames())
+		if err != nil {
+			log.Error().Err(err).Str("publisher", entry.name).Msg("failed to publish")
+		}
+		// The error is written before done is closed, so readers which observe done being closed also observe it.
+		entry.err = err
+	}()
+}
+
+// stop cancels a publisher which is running and returns a channel which is closed when it has returned. It must be
+// called with the lock held, but the caller must release the lock before waiting on the channel.
+func (m *Manager) stop(entry *managedPublisher) <-chan struct{} {
+	if entry.done == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	entry.cancel()
+	m.fanout.Unsubscribe(entry.subscription)
+	return entry.done
+}
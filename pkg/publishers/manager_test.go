@@ -0,0 +1,226 @@
+package publishers
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// channelPublisher forwards frames to a channel.
+type channelPublisher struct {
+	received chan *frames.Frame
+}
+
+func (p *channelPublisher) Publish(ctx context.Context, _ InitialsProvider, feed <-chan *frames.Frame) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame, ok := <-feed:
+			if !ok {
+				return feedClosed(ctx)
+			}
+			p.received <- frame
+		}
+	}
+}
+
+// failingPublisher returns an error immediately.
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, InitialsProvider, <-chan *frames.Frame) error {
+	return errors.New("disk full")
+}
+
+// closingPublisher counts how many times it is closed.
+type closingPublisher struct {
+	failingPublisher
+	closed int
+}
+
+func (p *closingPublisher) Close() error {
+	p.closed++
+	return nil
+}
+
+func receive(t *testing.T, received <-chan *frames.Frame) *frames.Frame {
+	t.Helper()
+	select {
+	case frame := <-received:
+		return frame
+	case <-time.After(5 * time.Second):
+		t.Fatal("no frame received")
+		return nil
+	}
+}
+
+func TestManagerAttachesWithSnapshot(t *testing.T) {
+	t.Parallel()
+	m := NewManager()
+	first := &channelPublisher{received: make(chan *frames.Frame, 16)}
+	require.NoError(t, m.Attach("first", first, 16, DropOldest))
+
+	m.Start(context.Background(), staticInitials{})
+	defer m.Stop()
+	m.Publish(testFrame(time.Second, "1a,Name=F-16C_50"))
+	assert.Equal(t, testFrame(time.Second, "1a,Name=F-16C_50"), receive(t, first.received))
+
+	second := &channelPublisher{received: make(chan *frames.Frame, 16)}
+	require.NoError(t, m.Attach("second", second, 16, DropOldest))
+	assert.Error(t, m.Attach("second", second, 16, DropOldest))
+	m.Publish(testFrame(2 * time.Second))
+	assert.Equal(t, testFrame(time.Second, "1a,Name=F-16C_50"), receive(t, second.received))
+	assert.Equal(t, testFrame(2*time.Second), receive(t, second.received))
+
+	require.NoError(t, m.Detach("first"))
+	assert.Error(t, m.Detach("first"))
+	assert.Equal(t, testFrame(2*time.Second), receive(t, first.received))
+	m.Publish(testFrame(3 * time.Second))
+	assert.Equal(t, testFrame(3*time.Second), receive(t, second.received))
+	assert.Empty(t, first.received)
+}
+
+func TestManagerRestartsFailedPublisher(t *testing.T) {
+	t.Parallel()
+	m := NewManager()
+	require.NoError(t, m.Attach("failing", failingPublisher{}, 16, DropOldest))
+	m.Start(context.Background(), staticInitials{})
+	defer m.Stop()
+
+	require.Eventually(t, func() bool {
+		statuses := m.Statuses()
+		return len(statuses) == 1 && !statuses[0].Running
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "disk full", m.Statuses()[0].Error)
+
+	require.NoError(t, m.Restart("failing"))
+	assert.Error(t, m.Restart("missing"))
+}
+
+func TestManagerReportsDisconnectedPublisher(t *testing.T) {
+	t.Parallel()
+	m := NewManager()
+	slow := &channelPublisher{received: make(chan *frames.Frame)}
+	require.NoError(t, m.Attach("slow", slow, 1, Disconnect))
+	m.Start(context.Background(), staticInitials{})
+	defer m.Stop()
+
+	m.Publish(testFrame(time.Second))
+	// The publisher holds the first frame until it is received, so the third frame overflows its queue.
+	require.Eventually(t, func() bool {
+		m.Publish(testFrame(2 * time.Second))
+		return len(m.fanout.Subscriptions()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		select {
+		case <-slow.received:
+		default:
+		}
+		return !m.Statuses()[0].Running
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ErrFeedClosed.Error(), m.Statuses()[0].Error)
+}
+
+func TestManagerClosesPublishers(t *testing.T) {
+	t.Parallel()
+	m := NewManager()
+	detached := &closingPublisher{}
+	kept := &closingPublisher{}
+	require.NoError(t, m.Attach("detached", detached, 16, DropOldest))
+	require.NoError(t, m.Attach("kept", kept, 16, DropOldest))
+
+	m.Start(context.Background(), staticInitials{})
+	m.Stop()
+	assert.Zero(t, detached.closed, "publishers stay open between recordings")
+
+	require.NoError(t, m.Detach("detached"))
+	assert.Equal(t, 1, detached.closed)
+	m.Close()
+	assert.Equal(t, 1, detached.closed)
+	assert.Equal(t, 1, kept.closed)
+}
+
+// steppedPublisher applies one frame from its feed to a world state each time it is stepped.
+type steppedPublisher struct {
+	step    chan struct{}
+	applied chan struct{}
+	state   *worldState
+}
+
+func (p *steppedPublisher) Publish(ctx context.Context, _ InitialsProvider, feed <-chan *frames.Frame) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.step:
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame, ok := <-feed:
+			if !ok {
+				return nil
+			}
+			p.state.apply(frame)
+			p.applied <- struct{}{}
+		}
+	}
+}
+
+// advance lets the publisher apply the given number of frames, and waits until it has.
+func (p *steppedPublisher) advance(t *testing.T, n int) {
+	t.Helper()
+	for range n {
+		p.step <- struct{}{}
+		select {
+		case <-p.applied:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no frame applied")
+		}
+	}
+}
+
+func TestManagerResynchronizesAfterDrop(t *testing.T) {
+	t.Parallel()
+	// The queue holds two frames, so two frames of each burst are discarded: the name change and the removal.
+	for policy, burst := range map[OverflowPolicy][]string{
+		DropOldest: {"1a,Name=F-16C_50", "-2b", "1a,T=1|2|3", "1a,T=4|5|6"},
+		DropNewest: {"1a,T=1|2|3", "1a,T=4|5|6", "1a,Name=F-16C_50", "-2b"},
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+			m := NewManager()
+			publisher := &steppedPublisher{step: make(chan struct{}), applied: make(chan struct{}), state: newWorldState()}
+			require.NoError(t, m.Attach("slow", publisher, 2, policy))
+			m.Start(context.Background(), staticInitials{})
+			defer m.Stop()
+
+			m.Publish(testFrame(time.Second, "1a,Name=F-16C,Color=Blue", "2b,Name=Su-27,Color=Red"))
+			publisher.advance(t, 1)
+
+			for i, line := range burst {
+				m.Publish(testFrame(time.Duration(i+2)*time.Second, line))
+			}
+			publisher.advance(t, 2)
+			m.Publish(testFrame(6*time.Second, "1a,T=7|8|9"))
+			publisher.advance(t, 1)
+			m.Publish(testFrame(7*time.Second, "1a,Color=Red"))
+			publisher.advance(t, 1)
+
+			assert.NotZero(t, m.Statuses()[0].Dropped)
+			assert.Equal(t, []uint64{0x1a}, slices.Sorted(maps.Keys(publisher.state.objects)), "the removed object is removed")
+			assert.Equal(t, map[string]string{
+				"Name":  "F-16C_50",
+				"Color": "Red",
+				"T":     "7|8|9",
+			}, publisher.state.objects[0x1a].Properties)
+		})
+	}
+}
@@ -2,33 +2,57 @@ package publishers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
 
+	"github.com/dharmab/acmi-exporter/pkg/frames"
 	"github.com/dharmab/goacmi/objects"
 	"github.com/dharmab/goacmi/properties"
 )
 
-// Publisher publishes ACMI messages to an output.
+// Publisher publishes frames to an output.
 type Publisher interface {
-	// Publish is a blocking function that publishes ACMI messages to an output until the context is cancelled.
-	Publish(ctx context.Context, initials InitialsProvider, messages <-chan string) error
+	// Publish is a blocking function that publishes frames to an output until the context is cancelled. Frames are
+	// shared between publishers and must not be modified. If the feed is closed before the context is cancelled,
+	// Publish returns ErrFeedClosed.
+	Publish(ctx context.Context, initials InitialsProvider, feed <-chan *frames.Frame) error
+}
+
+// ErrFeedClosed is returned by a publisher whose feed was closed while it was still publishing, such as when it fell
+// behind and was disconnected.
+var ErrFeedClosed = errors.New("feed closed")
+
+// feedClosed returns the error for a feed which was closed: nil if the context was cancelled, since the feed is closed
+// when a publisher is stopped, and ErrFeedClosed otherwise.
+func feedClosed(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return ErrFeedClosed
 }
 
 // InitialsProvider provides initial object state.
 type InitialsProvider interface {
-	// Get returns the ACMI lines for the initial global object and navaids state.
-	Get() ([]string, error)
+	// Get returns updates which set the initial global properties and navaids.
+	Get() ([]*objects.Update, error)
 }
 
-// Initials implements [InitialsProvider].
+// Initials implements [InitialsProvider]. It is safe for concurrent use once it is shared with publishers, provided
+// that it is only changed through Refresh.
 type Initials struct {
 	Global    *objects.Object
 	Bullseyes []*objects.Object
+	lock      sync.RWMutex
 }
 
 // Get implements [InitialsProvider.Get].
-func (i *Initials) Get() ([]string, error) {
-	lines := []string{}
+func (i *Initials) Get() ([]*objects.Update, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	updates := []*objects.Update{}
 	for _, propName := range []string{
 		properties.ReferenceTime,
 		properties.RecordingTime,
@@ -40,19 +64,61 @@ func (i *Initials) Get() ([]string, error) {
 	} {
 		value, ok := i.Global.GetProperty(propName)
 		if !ok {
-			return lines, fmt.Errorf("missing global property %q", propName)
+			return updates, fmt.Errorf("missing global property %q", propName)
 		}
-		update := objects.Update{
+		updates = append(updates, &objects.Update{
 			ID:         i.Global.ID,
 			IsRemoval:  false,
 			Properties: map[string]string{propName: value},
-		}
-		lines = append(lines, update.String())
+		})
 	}
 
 	for _, obj := range i.Bullseyes {
-		lines = append(lines, obj.String())
+		updates = append(updates, objectUpdate(obj))
+	}
+
+	return updates, nil
+}
+
+// Refresh replaces the global object and bullseyes with their current values, so that publishers which start later
+// receive them. It returns updates for each property which changed. The recording time is kept, since it records when
+// the recording started.
+func (i *Initials) Refresh(global *objects.Object, bullseyes []*objects.Object) []*objects.Update {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	global = &objects.Object{ID: global.ID, Properties: maps.Clone(global.Properties)}
+	if recordingTime, ok := i.Global.GetProperty(properties.RecordingTime); ok {
+		global.SetProperty(properties.RecordingTime, recordingTime)
+	}
+	var updates []*objects.Update
+	if update, ok := changedProperties(i.Global, global); ok {
+		updates = append(updates, update)
+	}
+	for _, bullseye := range bullseyes {
+		index := slices.IndexFunc(i.Bullseyes, func(o *objects.Object) bool { return o.ID == bullseye.ID })
+		if index < 0 {
+			updates = append(updates, objectUpdate(bullseye))
+			continue
+		}
+		if update, ok := changedProperties(i.Bullseyes[index], bullseye); ok {
+			updates = append(updates, update)
+		}
 	}
 
-	return lines, nil
+	i.Global = global
+	i.Bullseyes = bullseyes
+	return updates
+}
+
+// changedProperties returns an update which sets the properties of next which differ from previous. Returns false if
+// nothing changed.
+func changedProperties(previous, next *objects.Object) (*objects.Update, bool) {
+	update := &objects.Update{ID: next.ID, Properties: make(map[string]string)}
+	for key, value := range next.Properties {
+		if previousValue, ok := previous.GetProperty(key); !ok || previousValue != value {
+			update.Properties[key] = value
+		}
+	}
+	return update, len(update.Properties) > 0
 }
@@ -0,0 +1,44 @@
+package publishers
+
+import (
+	"testing"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitialsRefresh(t *testing.T) {
+	t.Parallel()
+	global := func(title, recordingTime string) *objects.Object {
+		return &objects.Object{ID: objects.GlobalObjectID, Properties: map[string]string{
+			properties.Title:         title,
+			properties.RecordingTime: recordingTime,
+		}}
+	}
+	bullseye := func(transform string) *objects.Object {
+		return &objects.Object{ID: 0x40000001, Properties: map[string]string{
+			properties.Transform: transform,
+			properties.Color:     "Blue",
+		}}
+	}
+	initials := &Initials{
+		Global:    global("Test", "2024-06-01T12:00:00Z"),
+		Bullseyes: []*objects.Object{bullseye("1|2|0")},
+	}
+
+	assert.Empty(t, initials.Refresh(global("Test", "2024-06-01T12:05:00Z"), []*objects.Object{bullseye("1|2|0")}))
+
+	changed := initials.Refresh(global("Test", "2024-06-01T12:10:00Z"), []*objects.Object{bullseye("3|4|0")})
+	require.Len(t, changed, 1)
+	assert.Equal(t, &objects.Update{ID: 0x40000001, Properties: map[string]string{properties.Transform: "3|4|0"}}, changed[0])
+
+	// Publishers which start later receive the current bullseye, and the original recording time.
+	updates := initials.Refresh(global("Renamed", "2024-06-01T12:15:00Z"), []*objects.Object{bullseye("3|4|0")})
+	require.Len(t, updates, 1)
+	assert.Equal(t, map[string]string{properties.Title: "Renamed"}, updates[0].Properties)
+	assert.Equal(t, "3|4|0", initials.Bullseyes[0].Properties[properties.Transform])
+	recordingTime, _ := initials.Global.GetProperty(properties.RecordingTime)
+	assert.Equal(t, "2024-06-01T12:00:00Z", recordingTime)
+}
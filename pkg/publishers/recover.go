@@ -0,0 +1,184 @@
+package publishers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// zipLocalFileHeaderSignature marks the start of a zip local file header.
+const zipLocalFileHeaderSignature = 0x04034b50
+
+// Recover repairs a recording which was truncated, for example because the exporter crashed while writing it. The
+// partial last line is trimmed and a removal is appended for every object which is still present at the end of the
+// recording. Compressed recordings are repaired by decompressing as much of the archive entry as possible and writing a
+// new archive. The file is replaced atomically.
+func Recover(path string) error {
+	logger := log.With().Str("path", path).Logger()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	compressed := strings.HasSuffix(path, ".zip.acmi")
+	entry := strings.TrimSuffix(filepath.Base(path), ".zip.acmi") + ".txt.acmi"
+	content := data
+	if compressed {
+		entry, content, err = readArchive(data)
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+	}
+
+	content, trimmed := trimPartialLine(content)
+	if !bytes.HasPrefix(content, []byte("FileType=text/acmi/tacview")) {
+		return errors.New("file does not contain an ACMI header")
+	}
+	state := newWorldState()
+	for _, line := range splitLines(string(content)) {
+		state.applyLine(line)
+	}
+	removals := state.removals(SpectatorView)
+	logger.Info().Int("trimmed", trimmed).Int("removals", len(removals)).Msg("repairing file")
+
+	var buffer bytes.Buffer
+	var w io.Writer = &buffer
+	var archive *zip.Writer
+	if compressed {
+		archive = zip.NewWriter(&buffer)
+		w, err = archive.CreateHeader(&zip.FileHeader{Name: entry, Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("failed to create archive entry: %w", err)
+		}
+	}
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("failed to write recovered content: %w", err)
+	}
+	for _, removal := range removals {
+		if _, err := io.WriteString(w, removal.String()+"\n"); err != nil {
+			return fmt.Errorf("failed to write closing line: %w", err)
+		}
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			return fmt.Errorf("failed to finalize archive: %w", err)
+		}
+	}
+
+	return replaceFile(path, buffer.Bytes())
+}
+
+// readArchive returns the name and content of the first entry in a zip archive. If the archive is truncated, as much
+// of the entry as can be decompressed is returned.
+func readArchive(data []byte) (string, []byte, error) {
+	if archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil && len(archive.File) > 0 {
+		file := archive.File[0]
+		r, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, zip.ErrChecksum) {
+			return "", nil, err
+		}
+		return file.Name, content, nil
+	}
+
+	// A truncated archive has no central directory, so the entry is located using its local file header.
+	const headerSize = 30
+	if len(data) < headerSize || binary.LittleEndian.Uint32(data) != zipLocalFileHeaderSignature {
+		return "", nil, errors.New("missing zip local file header")
+	}
+	method := binary.LittleEndian.Uint16(data[8:])
+	nameLength := int(binary.LittleEndian.Uint16(data[26:]))
+	extraLength := int(binary.LittleEndian.Uint16(data[28:]))
+	if len(data) < headerSize+nameLength+extraLength {
+		return "", nil, errors.New("truncated zip local file header")
+	}
+	name := string(data[headerSize : headerSize+nameLength])
+	compressed := data[headerSize+nameLength+extraLength:]
+	switch method {
+	case zip.Store:
+		return name, compressed, nil
+	case zip.Deflate:
+		r := flate.NewReader(bytes.NewReader(compressed))
+		defer r.Close()
+		// Reading stops with an error at the point of truncation. Everything decompressed before that is kept.
+		content, _ := io.ReadAll(r)
+		return name, content, nil
+	}
+	return "", nil, fmt.Errorf("unsupported compression method %d", method)
+}
+
+// trimPartialLine removes an incomplete last line from ACMI content, including a multi-line value whose continuation
+// was cut off. Returns the trimmed content and the number of bytes removed.
+func trimPartialLine(content []byte) ([]byte, int) {
+	original := len(content)
+	end := bytes.LastIndexByte(content, '\n') + 1
+	content = content[:end]
+	// A newline escaped with a backslash continues the line, so a line ending with one is incomplete.
+	for bytes.HasSuffix(content, []byte("\\\n")) {
+		end = bytes.LastIndexByte(content[:len(content)-1], '\n') + 1
+		content = content[:end]
+	}
+	return content, original - len(content)
+}
+
+// splitLines splits ACMI content into lines, keeping escaped newlines within their line.
+func splitLines(content string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '\n':
+			lines = append(lines, strings.TrimSuffix(content[start:i], "\r"))
+			start = i + 1
+		}
+	}
+	if start < len(content) {
+		lines = append(lines, content[start:])
+	}
+	return lines
+}
+
+// replaceFile atomically replaces the file at the given path with the given data, preserving its permissions.
+func replaceFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions on temporary file: %w", err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package publishers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "Test.acmi")
+	truncated := "FileType=text/acmi/tacview\nFileVersion=2.2\n0,Title=Test\n#1.00\n1a,T=1|2|3,Name=F-16C_50\n2b,T=4|5|6,Name=Su-27\n#2.00\n-2b\n0,Event=Message|1a|first\\\nsecond\\\n1a,T=7|8"
+	require.NoError(t, os.WriteFile(path, []byte(truncated), 0o644))
+
+	require.NoError(t, Recover(path))
+
+	recovered, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "FileType=text/acmi/tacview\nFileVersion=2.2\n0,Title=Test\n#1.00\n1a,T=1|2|3,Name=F-16C_50\n2b,T=4|5|6,Name=Su-27\n#2.00\n-2b\n-1a,\n", string(recovered))
+}
+
+func TestRecoverCompressed(t *testing.T) {
+	t.Parallel()
+	var content strings.Builder
+	content.WriteString("FileType=text/acmi/tacview\nFileVersion=2.2\n")
+	for i := range 20000 {
+		fmt.Fprintf(&content, "#%d.00\n%x,T=%d|%d|%d\n", i, i%97+1, i, i*7, i*13)
+	}
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: "Test.txt.acmi", Method: zip.Deflate})
+	require.NoError(t, err)
+	_, err = io.WriteString(w, content.String())
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	// Simulate a crash by discarding the end of the archive, including the central directory.
+	path := filepath.Join(t.TempDir(), "Test.zip.acmi")
+	require.NoError(t, os.WriteFile(path, buffer.Bytes()[:buffer.Len()/2], 0o644))
+
+	require.NoError(t, Recover(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, reader.File, 1)
+	assert.Equal(t, "Test.txt.acmi", reader.File[0].Name)
+	entry, err := reader.File[0].Open()
+	require.NoError(t, err)
+	defer entry.Close()
+	recovered, err := io.ReadAll(entry)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(recovered), "FileType=text/acmi/tacview\n"))
+	assert.True(t, strings.HasSuffix(string(recovered), ",\n"))
+	assert.Greater(t, len(recovered), 1000)
+	assert.Contains(t, string(recovered), "\n-1,\n")
+}
@@ -0,0 +1,53 @@
+package publishers
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Decoder decodes a publisher's options into the given struct. Options are matched to fields using their
+// `mapstructure` tags.
+type Decoder func(options any) error
+
+// Factory creates a publisher from its options.
+type Factory func(decode Decoder) (Publisher, error)
+
+var (
+	factories     = make(map[string]Factory)
+	factoriesLock sync.RWMutex
+)
+
+// Register makes a publisher type available to [Build] under the given name. It panics if the name is already
+// registered.
+func Register(kind string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if _, ok := factories[kind]; ok {
+		panic(fmt.Sprintf("publisher type %q is already registered", kind))
+	}
+	factories[kind] = factory
+}
+
+// Build creates a publisher of the given type.
+func Build(kind string, decode Decoder) (Publisher, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[kind]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown publisher type %q (known types: %v)", kind, Kinds())
+	}
+	return factory(decode)
+}
+
+// Kinds returns the names of all registered publisher types in sorted order.
+func Kinds() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
@@ -0,0 +1,32 @@
+package publishers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+	publisher, err := Build("server", func(options any) error {
+		server := options.(*Server)
+		server.Address = "localhost:42675"
+		server.Delay = time.Minute
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &Server{Address: "localhost:42675", Delay: time.Minute}, publisher)
+
+	_, err = Build("file", func(any) error { return nil })
+	assert.ErrorContains(t, err, "folder")
+
+	_, err = Build("carrier-pigeon", func(any) error { return nil })
+	assert.ErrorContains(t, err, "unknown publisher type")
+}
+
+func TestKinds(t *testing.T) {
+	t.Parallel()
+	assert.Subset(t, Kinds(), []string{"file", "server", "stdout"})
+}
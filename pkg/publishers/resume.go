@@ -0,0 +1,211 @@
+package publishers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/rs/zerolog/log"
+)
+
+// resumable describes an existing recording which a FilePublisher may continue.
+type resumable struct {
+	path string
+	// length is the length of the file up to the end of its last complete line.
+	length int64
+	// firstFrame and lastFrame are the mission times of the first and last frames in the file.
+	firstFrame time.Duration
+	lastFrame  time.Duration
+	// state is the world state at the end of the file.
+	state *worldState
+}
+
+// findResumable returns the most recently modified uncompressed recording in the folder which has the same title,
+// reference time and reference point as the given initials, or nil if there is none.
+func (p *FilePublisher) findResumable(initials InitialsProvider) (*resumable, error) {
+	initialUpdates, err := initials.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get initials: %w", err)
+	}
+	global := globalProperties(initialUpdates)
+	title, ok := global[properties.Title]
+	if !ok {
+		return nil, nil
+	}
+	referenceTime, ok := global[properties.ReferenceTime]
+	if !ok {
+		return nil, nil
+	}
+	referenceLongitude := global[properties.ReferenceLongitude]
+	referenceLatitude := global[properties.ReferenceLatitude]
+
+	entries, err := os.ReadDir(p.Folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read folder: %w", err)
+	}
+	var latest os.DirEntry
+	var latestTime time.Time
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, p.Title+" ") || !strings.HasSuffix(name, ".acmi") || strings.HasSuffix(name, ".zip.acmi") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if latest == nil || info.ModTime().After(latestTime) {
+			latest = entry
+			latestTime = info.ModTime()
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	candidate, err := scanRecording(filepath.Join(p.Folder, latest.Name()))
+	if err != nil {
+		return nil, err
+	}
+	global = make(map[string]string)
+	if object, ok := candidate.state.objects[objects.GlobalObjectID]; ok {
+		global = object.Properties
+	}
+	// Transforms are relative to the reference point, so a recording with a different reference point cannot be
+	// continued.
+	if global[properties.Title] != title || global[properties.ReferenceTime] != referenceTime ||
+		global[properties.ReferenceLongitude] != referenceLongitude || global[properties.ReferenceLatitude] != referenceLatitude {
+		return nil, nil
+	}
+	return candidate, nil
+}
+
+// scanRecording reads an uncompressed recording to find the end of its last complete line, its first and last frames,
+// and its world state.
+func scanRecording(path string) (*resumable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	candidate := &resumable{
+		path:       path,
+		firstFrame: -1,
+		state:      newWorldState(),
+	}
+	reader := bufio.NewReaderSize(file, fileBufferSize)
+	var offset int64
+	var line strings.Builder
+	for {
+		chunk, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything after the last complete line is a partial line.
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		offset += int64(len(chunk))
+		line.WriteString(chunk)
+		// A newline escaped with a backslash continues the line.
+		if strings.HasSuffix(chunk, "\\\n") {
+			continue
+		}
+		complete := strings.TrimSuffix(strings.TrimSuffix(line.String(), "\n"), "\r")
+		line.Reset()
+		candidate.length = offset
+		if missionTime, ok := parseFrame(complete); ok {
+			if candidate.firstFrame < 0 {
+				candidate.firstFrame = missionTime
+			}
+			candidate.lastFrame = missionTime
+		}
+		candidate.state.applyLine(complete)
+	}
+	return candidate, nil
+}
+
+// resume opens an existing recording to continue it. A partial last line is trimmed, and removals are written for any
+// objects which remain from before the exporter stopped, since they may no longer exist. Objects set by the initials,
+// such as bullseyes, are not written again by the feed, so they are updated instead of removed.
+func (p *FilePublisher) resume(candidate *resumable, initials InitialsProvider) (*recording, error) {
+	initialUpdates, err := initials.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get initials: %w", err)
+	}
+	initialObjects := make(map[uint64]*objects.Update)
+	for _, update := range initialUpdates {
+		if update.ID != objects.GlobalObjectID && !update.IsRemoval {
+			initialObjects[update.ID] = update
+		}
+	}
+
+	r := &recording{
+		sequence:   1,
+		created:    time.Now(),
+		startTime:  candidate.firstFrame,
+		time:       candidate.lastFrame,
+		serializer: frames.NewACMISerializer(),
+		logger:     log.With().Str("path", candidate.path).Logger(),
+	}
+	r.logger.Info().Stringer("lastFrame", candidate.lastFrame).Msg("resuming file")
+	file, err := os.OpenFile(candidate.path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	if err := file.Truncate(candidate.length); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to trim partial line: %w", err)
+	}
+	if _, err := file.Seek(candidate.length, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek to end of file: %w", err)
+	}
+	r.file = file
+	r.size = candidate.length
+	r.buffer = bufio.NewWriterSize(&countingWriter{writer: file, count: &r.size}, fileBufferSize)
+	r.writer = r.buffer
+
+	for _, removal := range candidate.state.removals(SpectatorView) {
+		if _, ok := initialObjects[removal.ID]; ok {
+			continue
+		}
+		if err := r.writeLine(removal.String()); err != nil {
+			r.close(nil)
+			return nil, fmt.Errorf("failed to write removal to file: %w", err)
+		}
+	}
+	for _, update := range initialUpdates {
+		if _, ok := initialObjects[update.ID]; !ok {
+			continue
+		}
+		if err := r.writeLine(update.String()); err != nil {
+			r.close(nil)
+			return nil, fmt.Errorf("failed to write initials to file: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// globalProperties returns the properties of the global object set by the given updates.
+func globalProperties(updates []*objects.Update) map[string]string {
+	global := make(map[string]string)
+	for _, update := range updates {
+		if update.ID != objects.GlobalObjectID || update.IsRemoval {
+			continue
+		}
+		for key, value := range update.Properties {
+			global[key] = value
+		}
+	}
+	return global
+}
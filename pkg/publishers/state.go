@@ -0,0 +1,266 @@
+package publishers
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+)
+
+// worldState tracks the current state of every object from a stream of frames, so that a complete snapshot can be
+// replayed to a subscriber which joins partway through a recording. It is not safe for concurrent use.
+type worldState struct {
+	// started is true once a frame has been applied.
+	started bool
+	// time is the mission time of the most recent frame.
+	time    time.Duration
+	objects map[uint64]*objects.Object
+	// removed maps the IDs of recently removed objects which were not recreated to their last Color property, so that
+	// events about them can be filtered by view. At most removedLimit objects are remembered.
+	removed map[uint64]removedObject
+	// removedOrder holds the removals in removed, oldest first.
+	removedOrder []removal
+	// removedCount counts the objects removed so far.
+	removedCount uint64
+}
+
+// removedLimit is the number of removed objects whose Color property is remembered.
+const removedLimit = 0x1000
+
+// removedObject is an object which was removed from the world state.
+type removedObject struct {
+	color string
+	// sequence distinguishes this removal from earlier removals of an object with the same ID.
+	sequence uint64
+}
+
+// removal identifies an entry in worldState.removed.
+type removal struct {
+	id       uint64
+	sequence uint64
+}
+
+func newWorldState() *worldState {
+	return &worldState{
+		objects: make(map[uint64]*objects.Object),
+		removed: make(map[uint64]removedObject),
+	}
+}
+
+// change describes the effect of a single update on the world state.
+type change struct {
+	// object is the object which was updated or removed, or nil if the update did not affect an object.
+	object *objects.Object
+	// previousColor is the object's Color property before the update was applied.
+	previousColor string
+}
+
+// apply updates the world state with a frame. Returns the change made by each of the frame's updates, in order.
+// Events are transient and are not part of the world state.
+func (w *worldState) apply(frame *frames.Frame) []change {
+	w.started = true
+	w.time = frame.Time
+	changes := make([]change, 0, len(frame.Updates))
+	for _, update := range frame.Updates {
+		changes = append(changes, w.applyUpdate(update))
+	}
+	return changes
+}
+
+// applyUpdate updates the world state with a single object update or removal.
+func (w *worldState) applyUpdate(update *objects.Update) change {
+	if update.IsRemoval {
+		object, ok := w.objects[update.ID]
+		if !ok {
+			return change{}
+		}
+		color, _ := object.GetProperty(properties.Color)
+		delete(w.objects, update.ID)
+		w.remember(update.ID, color)
+		return change{object: object, previousColor: color}
+	}
+	object, ok := w.objects[update.ID]
+	if !ok {
+		object = objects.New(update.ID)
+		w.objects[update.ID] = object
+		delete(w.removed, update.ID)
+	}
+	previousColor, _ := object.GetProperty(properties.Color)
+	for key, value := range update.Properties {
+		// Transforms may be sparse, so they are merged with the previous transform.
+		if previous, ok := object.Properties[key]; ok && key == properties.Transform {
+			value = frames.MergeTransform(previous, value)
+		}
+		object.Properties[key] = value
+	}
+	return change{object: object, previousColor: previousColor}
+}
+
+// seed adds the objects set by the initials, such as bullseyes, so that later changes to them are applied to complete
+// objects. The global object is not added, since its properties are sent with the initials. Seeding does not start the
+// world state.
+func (w *worldState) seed(initialUpdates []*objects.Update) {
+	for _, update := range initialUpdates {
+		if update.ID != objects.GlobalObjectID && !update.IsRemoval {
+			w.applyUpdate(update)
+		}
+	}
+}
+
+// remember records the Color property of a removed object, and forgets the oldest removed objects beyond
+// removedLimit.
+func (w *worldState) remember(id uint64, color string) {
+	w.removedCount++
+	w.removed[id] = removedObject{color: color, sequence: w.removedCount}
+	w.removedOrder = append(w.removedOrder, removal{id: id, sequence: w.removedCount})
+	for len(w.removedOrder) > removedLimit {
+		oldest := w.removedOrder[0]
+		w.removedOrder = w.removedOrder[1:]
+		// The object may have been recreated, or removed again since.
+		if removed, ok := w.removed[oldest.id]; ok && removed.sequence == oldest.sequence {
+			delete(w.removed, oldest.id)
+		}
+	}
+}
+
+// applyLine updates the world state with a single line read from an ACMI file. Lines which cannot be parsed are
+// ignored.
+func (w *worldState) applyLine(line string) {
+	if missionTime, ok := parseFrame(line); ok {
+		w.started = true
+		w.time = missionTime
+		return
+	}
+	update, ok := parseUpdate(line)
+	if !ok {
+		return
+	}
+	if update.ID == objects.GlobalObjectID {
+		delete(update.Properties, frames.EventProperty)
+		if len(update.Properties) == 0 {
+			return
+		}
+	}
+	w.applyUpdate(update)
+}
+
+// color returns the Color property of a current or removed object.
+func (w *worldState) color(id uint64) (string, bool) {
+	if object, ok := w.objects[id]; ok {
+		return object.GetProperty(properties.Color)
+	}
+	removed, ok := w.removed[id]
+	return removed.color, ok
+}
+
+// snapshot returns a frame at the current mission time which recreates the world state as seen in the given view:
+// every visible object and its properties. Returns nil if no frame has been applied.
+func (w *worldState) snapshot(view View) *frames.Frame {
+	if !w.started {
+		return nil
+	}
+	ids := make([]uint64, 0, len(w.objects))
+	for id, object := range w.objects {
+		if view.allows(object) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	frame := &frames.Frame{Time: w.time, Updates: make([]*objects.Update, 0, len(ids))}
+	for _, id := range ids {
+		frame.Updates = append(frame.Updates, objectUpdate(w.objects[id]))
+	}
+	return frame
+}
+
+// resync returns a frame which brings a subscriber that missed the given frames up to date: a removal for every object
+// removed in the missed frames, and every visible object and its properties. The missed frames must already be
+// filtered for the view.
+func (w *worldState) resync(view View, missed []*frames.Frame) *frames.Frame {
+	frame := &frames.Frame{Time: w.time}
+	removed := make(map[uint64]struct{})
+	for _, m := range missed {
+		for _, update := range m.Updates {
+			if update.IsRemoval {
+				removed[update.ID] = struct{}{}
+			}
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(removed)) {
+		frame.Updates = append(frame.Updates, &objects.Update{ID: id, IsRemoval: true})
+	}
+	if snapshot := w.snapshot(view); snapshot != nil {
+		frame.Updates = append(frame.Updates, snapshot.Updates...)
+	}
+	return frame
+}
+
+// removals returns a removal for every object visible in the given view except the global object, in ID order. They
+// are written at the end of a recording so that no object outlives it.
+func (w *worldState) removals(view View) []*objects.Update {
+	ids := make([]uint64, 0, len(w.objects))
+	for id, object := range w.objects {
+		if id != objects.GlobalObjectID && view.allows(object) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	removals := make([]*objects.Update, 0, len(ids))
+	for _, id := range ids {
+		removals = append(removals, &objects.Update{ID: id, IsRemoval: true})
+	}
+	return removals
+}
+
+// objectUpdate returns an update which sets every property of the object. The properties are copied, so the update is
+// not affected by later changes to the object.
+func objectUpdate(object *objects.Object) *objects.Update {
+	return &objects.Update{ID: object.ID, Properties: maps.Clone(object.Properties)}
+}
+
+// parseUpdate parses an object update or removal line.
+func parseUpdate(line string) (*objects.Update, bool) {
+	if line == "" {
+		return nil, false
+	}
+	update := &objects.Update{Properties: make(map[string]string)}
+	if line[0] == '-' {
+		update.IsRemoval = true
+		line = line[1:]
+	}
+	fields := splitFields(line)
+	id, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return nil, false
+	}
+	update.ID = id
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		update.Properties[key] = value
+	}
+	return update, true
+}
+
+// splitFields splits an ACMI line on commas which are not escaped by a backslash. Escape sequences are preserved.
+func splitFields(line string) []string {
+	var fields []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ',':
+			fields = append(fields, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, line[start:])
+}
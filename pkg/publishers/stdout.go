@@ -3,32 +3,85 @@ package publishers
 import (
 	"context"
 	"fmt"
+	"os"
 
+	"github.com/dharmab/acmi-exporter/pkg/frames"
 	"github.com/rs/zerolog/log"
 )
 
-// StdoutPublisher publishes ACMI messages to stdout.
-type StdoutPublisher struct{}
+// Format is an encoding for frames.
+type Format string
+
+const (
+	// ACMIFormat encodes frames as ACMI text.
+	ACMIFormat Format = "acmi"
+	// JSONFormat encodes frames as JSON Lines.
+	JSONFormat Format = "json"
+)
+
+// ParseFormat parses a format from its name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case ACMIFormat, JSONFormat:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// serializer creates a serializer for the format. Defaults to ACMIFormat.
+func (f Format) serializer() frames.Serializer {
+	if f == JSONFormat {
+		return &frames.JSONSerializer{}
+	}
+	return frames.NewACMISerializer()
+}
+
+// StdoutPublisher publishes frames to stdout.
+type StdoutPublisher struct {
+	// Format of the output. Defaults to ACMIFormat.
+	Format Format `mapstructure:"format"`
+}
 
 var _ Publisher = &StdoutPublisher{}
 
-// Publish implements [Publisher.Publish] by writing messages to stdout.
-func (p *StdoutPublisher) Publish(ctx context.Context, initials InitialsProvider, messages <-chan string) error {
+func init() {
+	Register("stdout", func(decode Decoder) (Publisher, error) {
+		p := &StdoutPublisher{}
+		if err := decode(p); err != nil {
+			return nil, err
+		}
+		if p.Format != "" {
+			if _, err := ParseFormat(string(p.Format)); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	})
+}
+
+// Publish implements [Publisher.Publish] by writing frames to stdout.
+func (p *StdoutPublisher) Publish(ctx context.Context, initials InitialsProvider, feed <-chan *frames.Frame) error {
 	log.Info().Msg("publishing to stdout")
+	serializer := p.Format.serializer()
 	i, err := initials.Get()
 	if err != nil {
 		return err
 	}
-	for s := range i {
-		fmt.Println(s)
+	if _, err := os.Stdout.Write(serializer.Initial(i)); err != nil {
+		return err
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case message := <-messages:
-			fmt.Println(message)
+		case frame, ok := <-feed:
+			if !ok {
+				return feedClosed(ctx)
+			}
+			if _, err := os.Stdout.Write(serializer.Frame(frame)); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -3,122 +3,576 @@ package publishers
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"hash/crc64"
+	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
 	"github.com/dharmab/skyeye/pkg/telemetry"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// Server listens for real-time telemetry client connections and publishes ACMI messages over TCP.
+// SlowClientPolicy determines what happens when a real-time telemetry client cannot keep up with the live feed.
+type SlowClientPolicy string
+
+const (
+	// ResyncSlowClients discards the frames queued for the client and replaces them with a snapshot of the current
+	// world state.
+	ResyncSlowClients SlowClientPolicy = "resync"
+	// DisconnectSlowClients closes the client's connection.
+	DisconnectSlowClients SlowClientPolicy = "disconnect"
+)
+
+// ParseSlowClientPolicy parses a slow client policy from its name.
+func ParseSlowClientPolicy(s string) (SlowClientPolicy, error) {
+	switch p := SlowClientPolicy(s); p {
+	case ResyncSlowClients, DisconnectSlowClients:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown slow client policy %q", s)
+}
+
+const (
+	// clientQueueSize is the number of frames which may be queued for a client before it is considered slow.
+	clientQueueSize = 0x10000
+	// clientBufferSize is the size of the write buffer for each client.
+	clientBufferSize = 0x10000
+	// flushInterval is how often buffered data is flushed to each client.
+	flushInterval = 100 * time.Millisecond
+	// writeTimeout is how long a single write or flush to a client may take.
+	writeTimeout = 10 * time.Second
+)
+
+// Server listens for real-time telemetry client connections and publishes ACMI data over TCP. The server keeps
+// listening, and clients stay connected, from one recording to the next until it is closed.
 type Server struct {
 	// Address to listen on.
-	Address string
-	// Password required for clients to connect.
-	Password string
+	Address string `mapstructure:"address"`
+	// Password required for clients to connect. Clients which connect with this password see every object.
+	Password string `mapstructure:"password"`
+	// Views maps additional passwords to restricted views. If views are configured and Password is empty, clients
+	// must use one of these passwords.
+	Views map[string]View `mapstructure:"views"`
+	// SlowClientPolicy determines what happens when a client cannot keep up. Defaults to ResyncSlowClients.
+	SlowClientPolicy SlowClientPolicy `mapstructure:"slow-client-policy"`
+	// Delay holds the feed back by the given duration, including the start of each new recording. New clients receive
+	// the initials as they were when the recording started and a snapshot of the world state as of the delayed point in
+	// time, which includes any later changes to the initials. Frames which are still held back when the server is
+	// closed are sent at once, before clients are disconnected.
+	Delay time.Duration `mapstructure:"delay"`
+
+	// lock guards runtime.
+	lock sync.Mutex
+	// runtime is the listener and the connected clients. It is created by the first call to Publish and lasts until
+	// Close is called.
+	runtime *serverRuntime
 }
 
-var _ Publisher = &Server{}
+var (
+	_ Publisher = &Server{}
+	_ io.Closer = &Server{}
+)
+
+func init() {
+	Register("server", func(decode Decoder) (Publisher, error) {
+		s := &Server{}
+		if err := decode(s); err != nil {
+			return nil, err
+		}
+		if s.Address == "" {
+			return nil, errors.New("address must not be empty")
+		}
+		if s.SlowClientPolicy != "" {
+			if _, err := ParseSlowClientPolicy(string(s.SlowClientPolicy)); err != nil {
+				return nil, err
+			}
+		}
+		for password, view := range s.Views {
+			if _, err := ParseView(string(view)); err != nil {
+				return nil, err
+			}
+			if password == s.Password {
+				return nil, fmt.Errorf("password for %s view must differ from the main password", view)
+			}
+		}
+		if s.Delay < 0 {
+			return nil, errors.New("delay must not be negative")
+		}
+		return s, nil
+	})
+}
 
 // Publish implements [Publisher.Publish] by listening for client connections on the server's address, negotiating a handshake, and writing ACMI data over TCP.
-func (s *Server) Publish(ctx context.Context, initials InitialsProvider, messages <-chan string) error {
-	listener, err := net.Listen("tcp", s.Address)
+// Each new client receives a snapshot of the current world state before the live feed. If the server is already
+// listening, connected clients are sent the ACMI header and the initials of the new recording, and every object of the
+// previous recording is removed.
+func (s *Server) Publish(ctx context.Context, initials InitialsProvider, feed <-chan *frames.Frame) error {
+	if s.Delay > 0 {
+		initials = fixInitials(initials)
+	}
+	rt, created, err := s.open(initials)
 	if err != nil {
 		return err
 	}
-	defer listener.Close()
-
-	handlers := make(map[string]*handler)
-	handlersLock := sync.RWMutex{}
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case message, ok := <-messages:
-				if !ok {
-					return
-				}
-				func() {
-					handlersLock.Lock()
-					defer handlersLock.Unlock()
-					for _, h := range handlers {
-						h.receiver <- message
-					}
-				}()
-			}
-		}
-	}()
-
+	if !created && !rt.enqueue(ctx, serverItem{initials: initials}) {
+		return nil
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
-			conn, err := listener.Accept()
-			if err != nil {
-				return err
+		case <-rt.failed:
+			s.discard(rt)
+			return rt.err
+		case frame, ok := <-feed:
+			if !ok {
+				if err := feedClosed(ctx); err != nil {
+					// Clients would otherwise stay connected to a feed which never changes.
+					s.discard(rt)
+					return err
+				}
+				return nil
 			}
-			h := &handler{
-				receiver: make(chan string, 0x10000),
-				password: s.Password,
+			if !rt.enqueue(ctx, serverItem{frame: frame}) {
+				return nil
 			}
-			remoteAddr := conn.RemoteAddr().String()
-			func() {
-				handlersLock.Lock()
-				defer handlersLock.Unlock()
-				handlers[remoteAddr] = h
-			}()
-			go func() {
-				defer func() {
-					handlersLock.Lock()
-					defer handlersLock.Unlock()
-					close(h.receiver)
-					conn.Close()
-					delete(handlers, remoteAddr)
-				}()
-				h.handle(conn, initials)
-			}()
 		}
 	}
 }
 
-type handler struct {
-	receiver chan string
-	password string
+// Close implements [io.Closer] by closing the listener and disconnecting every client once it has been sent every
+// frame.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	rt := s.runtime
+	s.runtime = nil
+	s.lock.Unlock()
+	if rt == nil {
+		return nil
+	}
+	return rt.close()
 }
 
-func (h *handler) handle(conn net.Conn, initials InitialsProvider) {
-	logger := log.With().Str("remote", conn.RemoteAddr().String()).Logger()
-	timeout := time.After(30 * time.Second)
-	initialLines := make([]string, 0)
+// open returns the server's runtime, and true if it was created by this call. A new runtime starts with the given
+// initials.
+func (s *Server) open(initials InitialsProvider) (*serverRuntime, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.runtime != nil {
+		return s.runtime, false, nil
+	}
+	listener, err := net.Listen("tcp", s.Address)
+	if err != nil {
+		return nil, false, err
+	}
+	policy := s.SlowClientPolicy
+	if policy == "" {
+		policy = ResyncSlowClients
+	}
+	rt := &serverRuntime{
+		listener: listener,
+		clients:  newClients(policy, initials),
+		items:    make(chan serverItem),
+		closing:  make(chan struct{}),
+		failed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.Delay > 0 {
+		log.Info().Str("address", s.Address).Stringer("delay", s.Delay).Msg("delaying telemetry")
+	}
+	go rt.run(s.Delay)
+	go rt.accept(s.passwordHashes())
+	s.runtime = rt
+	return rt, true, nil
+}
+
+// discard closes a runtime which failed, so that the next call to Publish listens again.
+func (s *Server) discard(rt *serverRuntime) {
+	s.lock.Lock()
+	if s.runtime == rt {
+		s.runtime = nil
+	}
+	s.lock.Unlock()
+	if err := rt.close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close listener")
+	}
+}
+
+// Passwords returns every password which clients may connect with. An empty password means that clients need no
+// password.
+func (s *Server) Passwords() []string {
+	passwords := make([]string, 0, len(s.Views)+1)
+	if s.Password != "" || len(s.Views) == 0 {
+		passwords = append(passwords, s.Password)
+	}
+	for password := range s.Views {
+		passwords = append(passwords, password)
+	}
+	return passwords
+}
+
+// passwordHashes returns a map of password hashes to the view granted by each password.
+func (s *Server) passwordHashes() map[string]View {
+	hashes := make(map[string]View)
+	if s.Password != "" || len(s.Views) == 0 {
+		hashes[hash(s.Password)] = SpectatorView
+	}
+	for password, view := range s.Views {
+		hashes[hash(password)] = view
+	}
+	return hashes
+}
+
+// serverRuntime is a listening server: its listener, its connected clients and the goroutines which feed them.
+type serverRuntime struct {
+	listener net.Listener
+	clients  *clients
+	// items carries the start of each recording and its frames from Publish to the run loop.
+	items chan serverItem
+	// closing is closed when the runtime is closed. done is closed when the run loop has returned.
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	// failed is closed if the listener fails. err is set before failed is closed.
+	failed chan struct{}
+	err    error
+}
+
+// serverItem is either the start of a new recording or a frame.
+type serverItem struct {
+	// initials is set if the item starts a new recording.
+	initials InitialsProvider
+	frame    *frames.Frame
+}
+
+// enqueue sends an item to the run loop. Returns false if the context is cancelled or the runtime is closed first.
+func (rt *serverRuntime) enqueue(ctx context.Context, item serverItem) bool {
+	select {
+	case rt.items <- item:
+		return true
+	case <-ctx.Done():
+	case <-rt.closing:
+	}
+	return false
+}
 
-	for len(initialLines) == 0 {
+// run applies each item to the clients, after the given delay, until the runtime is closed.
+func (rt *serverRuntime) run(delay time.Duration) {
+	defer close(rt.done)
+	if delay > 0 {
+		for item := range delayItems(rt.closing, rt.items, delay) {
+			rt.clients.apply(item)
+		}
+		return
+	}
+	for {
 		select {
-		case <-timeout:
-			log.Error().Msg("client handshake timed out")
+		case <-rt.closing:
 			return
-		default:
-			var err error
-			initialLines, err = initials.Get()
-			if err != nil {
-				log.Error().Err(err).Msg("failed to get initial lines")
+		case item := <-rt.items:
+			rt.clients.apply(item)
+		}
+	}
+}
+
+// accept serves each client which connects until the listener is closed.
+func (rt *serverRuntime) accept(passwords map[string]View) {
+	for {
+		conn, err := rt.listener.Accept()
+		if err != nil {
+			select {
+			case <-rt.closing:
+			default:
+				rt.err = err
+				close(rt.failed)
 			}
+			return
 		}
+		h := newHandler(conn, passwords, clientQueueSize)
+		go func() {
+			defer rt.clients.unregister(h)
+			h.handle(rt.clients)
+		}()
 	}
+}
 
-	if err := conn.SetDeadline(time.Now().Add(60 * time.Second)); err != nil {
-		logger.Error().Err(err).Msg("failed to set deadline")
+// close closes the listener, stops the run loop once it has broadcast any delayed items, and disconnects every client
+// once its queue is written.
+func (rt *serverRuntime) close() error {
+	var err error
+	rt.closeOnce.Do(func() {
+		close(rt.closing)
+		err = rt.listener.Close()
+		<-rt.done
+		rt.clients.closeAll()
+	})
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// clients tracks connected clients and the world state which is replayed to them.
+type clients struct {
+	// lock guards the fields below, so that a new handler's initials, snapshot and subsequent frames are consistent.
+	lock     sync.Mutex
+	handlers map[*handler]struct{}
+	// initials provides the initials of the current recording.
+	initials InitialsProvider
+	state    *worldState
+	policy   SlowClientPolicy
+	// closed is true once closeAll has been called. No further handlers may be registered.
+	closed bool
+}
+
+func newClients(policy SlowClientPolicy, initials InitialsProvider) *clients {
+	return &clients{
+		handlers: make(map[*handler]struct{}),
+		initials: initials,
+		state:    seededState(initials),
+		policy:   policy,
+	}
+}
+
+// seededState returns a world state which holds the objects set by the initials. Updates to those objects, such as a
+// bullseye which moves, may carry only the properties which changed, and are filtered by the object's Color property.
+func seededState(initials InitialsProvider) *worldState {
+	state := newWorldState()
+	initialUpdates, err := initials.Get()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get initials for world state")
+	}
+	state.seed(initialUpdates)
+	return state
+}
+
+// register adds an authorized handler and captures the initials and snapshot which it will send before the live feed.
+// Returns false if the clients have been closed.
+func (c *clients) register(h *handler) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return false
+	}
+	c.handlers[h] = struct{}{}
+	h.initials = c.initials
+	h.snapshot = c.state.snapshot(h.view)
+	return true
+}
+
+// unregister removes a handler and closes its connection and queue.
+func (c *clients) unregister(h *handler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	h.conn.Close()
+	if _, ok := c.handlers[h]; !ok {
 		return
 	}
-	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	delete(c.handlers, h)
+	close(h.receiver)
+}
+
+// closeAll unregisters every handler and closes its queue. Each handler writes what is already queued before it closes
+// its connection.
+func (c *clients) closeAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	for h := range c.handlers {
+		delete(c.handlers, h)
+		close(h.receiver)
+	}
+}
 
-	logger.Info().Msg("negotiating handshake")
+// apply starts a new recording or broadcasts a frame.
+func (c *clients) apply(item serverItem) {
+	if item.initials != nil {
+		c.restart(item.initials)
+		return
+	}
+	c.broadcast(item.frame)
+}
+
+// restart begins a new recording with the given initials. Every client is sent a removal for each object it can see,
+// followed by the ACMI header and the new initials.
+func (c *clients) restart(initials InitialsProvider) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	previous := c.state
+	c.state = seededState(initials)
+	c.initials = initials
+	for h := range c.handlers {
+		removals := &frames.Frame{Time: previous.time, Updates: previous.removals(h.view)}
+		c.deliver(h, delivery{restart: &restart{removals: removals, initials: initials}})
+	}
+}
+
+// broadcast applies the frame to the world state and queues it for every client, filtered by the client's view,
+// without blocking. Clients whose queues are full are handled according to the slow client policy.
+func (c *clients) broadcast(frame *frames.Frame) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	changes := c.state.apply(frame)
+	for h := range c.handlers {
+		c.deliver(h, delivery{frame: c.filter(h.view, frame, changes)})
+	}
+}
+
+// deliver queues a delivery for a client without blocking. If the client's queue is full, it is handled according to
+// the slow client policy. It must be called with the lock held.
+func (c *clients) deliver(h *handler, d delivery) {
+	select {
+	case h.receiver <- d:
+		return
+	default:
+	}
+	switch c.policy {
+	case DisconnectSlowClients:
+		h.logger.Warn().Msg("client is too slow, disconnecting")
+		delete(c.handlers, h)
+		close(h.receiver)
+		h.conn.Close()
+	default:
+		h.logger.Warn().Msg("client is too slow, resynchronizing from snapshot")
+		// Discard everything queued. Any delivery the handler is currently writing predates the snapshot, so sending
+		// the snapshot through the same queue keeps the feed in order. The removals in the discarded frames are sent
+		// with the snapshot. If the start of a new recording was discarded, the client is restarted before the
+		// snapshot, and the frames of the previous recording no longer matter.
+		queued := make([]delivery, 0, len(h.receiver)+1)
+		for drained := false; !drained; {
+			select {
+			case q := <-h.receiver:
+				queued = append(queued, q)
+			default:
+				drained = true
+			}
+		}
+		queued = append(queued, d)
+		var resync delivery
+		var missed []*frames.Frame
+		for _, q := range queued {
+			if q.restart != nil {
+				// The first restart removes every object the client has seen.
+				if resync.restart == nil {
+					resync.restart = &restart{removals: q.restart.removals}
+				}
+				resync.restart.initials = q.restart.initials
+				missed = nil
+			}
+			if q.frame != nil {
+				missed = append(missed, q.frame)
+			}
+		}
+		if c.state.started {
+			resync.frame = c.state.resync(h.view, missed)
+		}
+		h.receiver <- resync
+	}
+}
+
+// filter returns the part of a frame which a client with the given view may see. An object which becomes visible is
+// sent in full, and an object which becomes hidden is removed. Events are sent if any of their objects is visible, with
+// the names of hidden objects removed.
+func (c *clients) filter(view View, frame *frames.Frame, changes []change) *frames.Frame {
+	if view == SpectatorView {
+		return frame
+	}
+	filtered := &frames.Frame{Time: frame.Time}
+	for i, update := range frame.Updates {
+		if visible, ok := filterUpdate(view, update, changes[i]); ok {
+			filtered.Updates = append(filtered.Updates, visible)
+		}
+	}
+	visible := func(id uint64) bool {
+		color, ok := c.state.color(id)
+		return ok && view.allowsColor(color)
+	}
+	for _, event := range frame.Events {
+		if redacted, ok := event.Redact(visible); ok {
+			filtered.Events = append(filtered.Events, redacted)
+		}
+	}
+	return filtered
+}
+
+// filterUpdate returns the update to send to a client with the given view, and false if nothing should be sent.
+func filterUpdate(view View, update *objects.Update, ch change) (*objects.Update, bool) {
+	if ch.object == nil {
+		return nil, false
+	}
+	wasVisible := view.allowsColor(ch.previousColor)
+	if update.IsRemoval {
+		return update, wasVisible
+	}
+	isVisible := view.allows(ch.object)
+	switch {
+	case wasVisible && isVisible:
+		return update, true
+	case isVisible:
+		return objectUpdate(ch.object), true
+	case wasVisible:
+		return &objects.Update{ID: ch.object.ID, IsRemoval: true}, true
+	}
+	return nil, false
+}
+
+type handler struct {
+	conn     net.Conn
+	receiver chan delivery
+	// passwords maps password hashes to the view granted by each password.
+	passwords map[string]View
+	// view restricts which objects are sent to the client. It is set during authorization.
+	view   View
+	logger zerolog.Logger
+	// initials provides the initials of the recording in progress when the handler was registered.
+	initials InitialsProvider
+	// snapshot is the world state at the moment the handler was registered, or nil if no frame had been published.
+	snapshot *frames.Frame
+	// serializer encodes frames for the client.
+	serializer *frames.ACMISerializer
+}
+
+// delivery is queued for a client. If both fields are set, the restart is written first.
+type delivery struct {
+	restart *restart
+	frame   *frames.Frame
+}
+
+// restart begins a new recording for a client which is already connected.
+type restart struct {
+	// removals removes the objects of the previous recording which the client can see.
+	removals *frames.Frame
+	initials InitialsProvider
+}
+
+func newHandler(conn net.Conn, passwords map[string]View, queueSize int) *handler {
+	return &handler{
+		conn:       conn,
+		receiver:   make(chan delivery, queueSize),
+		passwords:  passwords,
+		serializer: frames.NewACMISerializer(),
+		logger:     log.With().Str("remote", conn.RemoteAddr().String()).Logger(),
+	}
+}
+
+// handle negotiates a handshake with the client, registers the handler with the clients and sends telemetry until
+// the connection fails or the handler is unregistered.
+func (h *handler) handle(c *clients) {
+	if err := h.conn.SetDeadline(time.Now().Add(60 * time.Second)); err != nil {
+		h.logger.Error().Err(err).Msg("failed to set deadline")
+		return
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriterSize(h.conn, clientBufferSize))
+
+	h.logger.Info().Msg("negotiating handshake")
 	serverHandshake := strings.Join([]string{
 		"XtraLib.Stream.0",
 		"Tacview.RealTimeTelemetry.0",
@@ -126,70 +580,174 @@ func (h *handler) handle(conn net.Conn, initials InitialsProvider) {
 	}, "\n") + string(rune(0))
 
 	if _, err := rw.WriteString(serverHandshake); err != nil {
-		logger.Error().Err(err).Msg("failed to write host handshake")
+		h.logger.Error().Err(err).Msg("failed to write host handshake")
 		return
 	}
 	if err := rw.Flush(); err != nil {
-		logger.Error().Err(err).Msg("failed to flush writer during handshake")
+		h.logger.Error().Err(err).Msg("failed to flush writer during handshake")
 		return
 	}
 
 	packet, err := rw.ReadString(0)
 	if err != nil {
-		logger.Warn().Err(err).Msg("failed to read client handshake")
+		h.logger.Warn().Err(err).Msg("failed to read client handshake")
 		return
 	}
-	if !h.authorize(packet, &logger) {
-		logger.Warn().Msg("client handshake failed authorization")
+	view, ok := h.authorize(packet, &h.logger)
+	if !ok {
+		h.logger.Warn().Msg("client handshake failed authorization")
+		return
+	}
+	h.view = view
+	h.logger = h.logger.With().Str("view", string(view)).Logger()
+	if !c.register(h) {
 		return
 	}
 
-	logger.Info().Msg("publishing telemetry")
-
-	for _, line := range initialLines {
-		if _, err := rw.WriteString(line + "\n"); err != nil {
-			logger.Error().Err(err).Msg("failed to write initial line")
+	timeout := time.After(30 * time.Second)
+	initialUpdates := make([]*objects.Update, 0)
+	for len(initialUpdates) == 0 {
+		select {
+		case <-timeout:
+			h.logger.Error().Msg("timed out reading initials")
 			return
+		default:
+			initialUpdates, err = h.initials.Get()
+			if err != nil {
+				h.logger.Error().Err(err).Msg("failed to get initials")
+			}
 		}
-		if err = rw.Flush(); err != nil {
-			logger.Error().Err(err).Msg("failed to flush writer")
+	}
+
+	h.logger.Info().Msg("publishing telemetry")
+
+	if _, err := rw.Write(h.serializer.Initial(h.visible(initialUpdates))); err != nil {
+		h.logger.Error().Err(err).Msg("failed to write initials")
+		return
+	}
+
+	if h.snapshot != nil {
+		h.logger.Info().Int("objects", len(h.snapshot.Updates)).Msg("writing world state snapshot")
+		if _, err := rw.Write(h.serializer.Frame(h.snapshot)); err != nil {
+			h.logger.Error().Err(err).Msg("failed to write snapshot")
 			return
 		}
+		h.snapshot = nil
+	}
+	if err := rw.Flush(); err != nil {
+		h.logger.Error().Err(err).Msg("failed to flush writer")
+		return
 	}
 
-	for message, ok := <-h.receiver; ok; {
-		if err := conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-			logger.Error().Err(err).Msg("failed to set write deadline")
-			return
+	if err := h.conn.SetDeadline(time.Time{}); err != nil {
+		h.logger.Error().Err(err).Msg("failed to clear deadline")
+		return
+	}
+	if err := h.send(rw.Writer); err != nil {
+		h.logger.Warn().Err(err).Msg("stopped publishing telemetry")
+	}
+}
+
+// visible returns the initial updates which the client's view allows.
+func (h *handler) visible(initialUpdates []*objects.Update) []*objects.Update {
+	visible := make([]*objects.Update, 0, len(initialUpdates))
+	for _, update := range initialUpdates {
+		if h.view.allowsUpdate(update) {
+			visible = append(visible, update)
 		}
-		if _, err := rw.WriteString(message + "\n"); err != nil {
-			logger.Error().Err(err).Msg("failed to write message")
-			return
+	}
+	return visible
+}
+
+// send writes queued deliveries to the client until the queue is closed. Frames are buffered and flushed periodically
+// rather than after every frame.
+func (h *handler) send(w *bufio.Writer) error {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case d, ok := <-h.receiver:
+			if !ok {
+				return h.flush(w)
+			}
+			// The buffered writer flushes on its own when full, so a deadline is needed for every write.
+			if err := h.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+				return fmt.Errorf("failed to set write deadline: %w", err)
+			}
+			if d.restart != nil {
+				if err := h.restart(w, d.restart); err != nil {
+					return err
+				}
+			}
+			if d.frame != nil {
+				if _, err := w.Write(h.serializer.Frame(d.frame)); err != nil {
+					return fmt.Errorf("failed to write frame: %w", err)
+				}
+			}
+		case <-ticker.C:
+			if err := h.flush(w); err != nil {
+				return err
+			}
 		}
-		if err := rw.Flush(); err != nil {
-			logger.Error().Err(err).Msg("failed to flush writer")
-			return
+	}
+}
+
+// restart removes the objects of the previous recording, and writes the ACMI header and the initials of the new
+// recording.
+func (h *handler) restart(w *bufio.Writer, r *restart) error {
+	h.logger.Info().Msg("starting new recording")
+	if len(r.removals.Updates) > 0 {
+		if _, err := w.Write(h.serializer.Frame(r.removals)); err != nil {
+			return fmt.Errorf("failed to write removals: %w", err)
 		}
 	}
+	initialUpdates, err := r.initials.Get()
+	if err != nil {
+		return fmt.Errorf("failed to get initials: %w", err)
+	}
+	h.serializer = frames.NewACMISerializer()
+	if _, err := w.WriteString(frames.Header + "\n"); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if _, err := w.Write(h.serializer.Initial(h.visible(initialUpdates))); err != nil {
+		return fmt.Errorf("failed to write initials: %w", err)
+	}
+	return nil
 }
 
-func (h *handler) authorize(packet string, logger *zerolog.Logger) bool {
+func (h *handler) flush(w *bufio.Writer) error {
+	if w.Buffered() == 0 {
+		return nil
+	}
+	if err := h.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return fmt.Errorf("failed to set write deadline: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush writer: %w", err)
+	}
+	return nil
+}
+
+// authorize returns the view granted by the password hash in the client's handshake, and false if the hash does not
+// match any configured password.
+func (h *handler) authorize(packet string, logger *zerolog.Logger) (View, bool) {
 	handshake, err := telemetry.DecodeClientHandshake(packet)
 
 	if err != nil {
 		logger.Warn().Err(err).Msg("failed to decode client handshake")
-		return false
+		return "", false
 	}
-	ok := handshake.PasswordHash == h.hash()
-	return ok
+	view, ok := h.passwords[handshake.PasswordHash]
+	return view, ok
 }
 
-func (h *handler) hash() string {
-	if h.password == "" {
+// hash returns the CRC64 hash of a password as used in the real-time telemetry handshake.
+func hash(password string) string {
+	if password == "" {
 		return "0"
 	}
 	table := crc64.MakeTable(crc64.ECMA)
-	data := []byte(h.password)
+	data := []byte(password)
 	hash := crc64.Checksum(data, table)
 	return strconv.FormatUint(hash, 10)
 }
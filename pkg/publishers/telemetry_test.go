@@ -0,0 +1,428 @@
+package publishers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties/events"
+	"github.com/dharmab/skyeye/pkg/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticInitials []string
+
+func (i staticInitials) Get() ([]*objects.Update, error) {
+	updates := make([]*objects.Update, 0, len(i))
+	for _, line := range i {
+		update, ok := parseUpdate(line)
+		if !ok {
+			return nil, fmt.Errorf("invalid initial line %q", line)
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// testFrame builds a frame at the given mission time from ACMI update lines.
+func testFrame(missionTime time.Duration, lines ...string) *frames.Frame {
+	frame := &frames.Frame{Time: missionTime}
+	for _, line := range lines {
+		update, ok := parseUpdate(line)
+		if !ok {
+			panic(fmt.Sprintf("invalid update line %q", line))
+		}
+		frame.Updates = append(frame.Updates, update)
+	}
+	return frame
+}
+
+// connect performs the client side of the handshake over the given connection.
+func connect(t *testing.T, conn net.Conn, password string) *bufio.Reader {
+	t.Helper()
+	reader := bufio.NewReader(conn)
+	hostHandshake, err := reader.ReadString(0)
+	require.NoError(t, err)
+	assert.Contains(t, hostHandshake, "Tacview.RealTimeTelemetry.0")
+	_, err = conn.Write([]byte(telemetry.NewClientHandshake("test", password).Encode()))
+	require.NoError(t, err)
+	return reader
+}
+
+// newTestHandler creates a handler which grants the spectator view to clients using the given password.
+func newTestHandler(conn net.Conn, password string, queueSize int) *handler {
+	h := newHandler(conn, map[string]View{hash(password): SpectatorView}, queueSize)
+	h.view = SpectatorView
+	return h
+}
+
+// readLines reads the given number of lines from the reader.
+func readLines(t *testing.T, reader *bufio.Reader, n int) []string {
+	t.Helper()
+	lines := make([]string, 0, n)
+	for range n {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	return lines
+}
+
+func TestHandlerSendsInitialsSnapshotAndFrames(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	c.broadcast(testFrame(time.Second, "1a,T=1|2|3,Name=F-16C_50"))
+	h := newTestHandler(server, "hunter2", 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer c.unregister(h)
+		h.handle(c)
+	}()
+
+	reader := connect(t, client, "hunter2")
+	assert.Equal(t, []string{"0,Title=Test", "#1.00"}, readLines(t, reader, 2))
+	object := readLines(t, reader, 1)[0]
+	assert.True(t, strings.HasPrefix(object, "1a,"))
+	assert.Contains(t, object, "Name=F-16C_50")
+
+	c.broadcast(testFrame(2*time.Second, "1a,T=4|5|6"))
+	c.broadcast(testFrame(2*time.Second, "1a,T=7|8|9"))
+	c.broadcast(testFrame(3 * time.Second))
+	assert.Equal(t, []string{"#2.00", "1a,T=4|5|6", "1a,T=7|8|9", "#3.00"}, readLines(t, reader, 4))
+
+	c.closeAll()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not stop after its queue was closed")
+	}
+}
+
+func TestHandlerRejectsWrongPassword(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	h := newTestHandler(server, "hunter2", 16)
+	go func() {
+		defer c.unregister(h)
+		h.handle(c)
+	}()
+
+	reader := connect(t, client, "wrong")
+	_, err := reader.ReadString('\n')
+	assert.Error(t, err)
+	assert.Empty(t, c.handlers)
+}
+
+func TestSlowClientIsResynchronized(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	// The handler is not started, so nothing drains its queue.
+	h := newTestHandler(server, "", 2)
+	c.register(h)
+
+	c.broadcast(testFrame(time.Second))
+	c.broadcast(testFrame(time.Second, "2b,Name=F-15C"))
+	// The queue is full, so this frame triggers a resynchronization.
+	c.broadcast(testFrame(time.Second, "-2b"))
+	c.broadcast(testFrame(time.Second, "1a,Name=F-16C_50"))
+
+	require.Len(t, h.receiver, 2)
+	assert.Equal(t, &frames.Frame{Time: time.Second, Updates: []*objects.Update{{ID: 0x2b, IsRemoval: true}}}, (<-h.receiver).frame)
+	assert.Equal(t, testFrame(time.Second, "1a,Name=F-16C_50"), (<-h.receiver).frame)
+}
+
+func TestResyncOmitsDeliveredRemovals(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	h := newTestHandler(server, "", 2)
+	c.register(h)
+
+	c.broadcast(testFrame(time.Second, "2b,Name=F-15C"))
+	c.broadcast(testFrame(2*time.Second, "-2b"))
+	// Both frames are delivered, so the removal is not sent again.
+	<-h.receiver
+	<-h.receiver
+
+	c.broadcast(testFrame(3*time.Second, "1a,Name=F-16C_50"))
+	c.broadcast(testFrame(4 * time.Second))
+	c.broadcast(testFrame(5 * time.Second))
+
+	require.Len(t, h.receiver, 1)
+	assert.Equal(t, testFrame(5*time.Second, "1a,Name=F-16C_50"), (<-h.receiver).frame)
+}
+
+func TestRemovedObjectsAreBounded(t *testing.T) {
+	t.Parallel()
+	state := newWorldState()
+	for id := uint64(1); id <= removedLimit+1; id++ {
+		state.apply(testFrame(time.Second, fmt.Sprintf("%x,Color=Red", id)))
+		state.apply(testFrame(time.Second, fmt.Sprintf("-%x", id)))
+	}
+	assert.Len(t, state.removed, removedLimit)
+	_, ok := state.color(1)
+	assert.False(t, ok, "the oldest removed object is forgotten")
+	color, ok := state.color(removedLimit + 1)
+	assert.True(t, ok)
+	assert.Equal(t, "Red", color)
+
+	// An object which is recreated and removed again is remembered from its latest removal.
+	state.apply(testFrame(time.Second, "2,Color=Blue"))
+	state.apply(testFrame(time.Second, "-2"))
+	for id := uint64(removedLimit + 2); id <= 2*removedLimit; id++ {
+		state.apply(testFrame(time.Second, fmt.Sprintf("%x,Color=Red", id)))
+		state.apply(testFrame(time.Second, fmt.Sprintf("-%x", id)))
+	}
+	color, ok = state.color(2)
+	assert.True(t, ok)
+	assert.Equal(t, "Blue", color)
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newClients(DisconnectSlowClients, staticInitials{"0,Title=Test"})
+	h := newTestHandler(server, "", 1)
+	c.register(h)
+
+	c.broadcast(testFrame(time.Second))
+	c.broadcast(testFrame(2 * time.Second))
+
+	assert.NotContains(t, c.handlers, h)
+	assert.Equal(t, testFrame(time.Second), (<-h.receiver).frame)
+	_, ok := <-h.receiver
+	assert.False(t, ok)
+	_, err := server.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestSlowClientDoesNotBlockOthers(t *testing.T) {
+	t.Parallel()
+	slowServer, slowClient := net.Pipe()
+	defer slowClient.Close()
+	fastServer, fastClient := net.Pipe()
+	defer fastClient.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	slow := newTestHandler(slowServer, "", 1)
+	c.register(slow)
+	fast := newTestHandler(fastServer, "", 16)
+	go func() {
+		defer c.unregister(fast)
+		fast.handle(c)
+	}()
+	reader := connect(t, fastClient, "")
+	readLines(t, reader, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			c.broadcast(testFrame(time.Duration(i+1) * time.Second))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked on a slow client")
+	}
+	assert.Len(t, readLines(t, reader, 10), 10)
+}
+
+func TestViewHidesOtherCoalition(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test"})
+	c.broadcast(testFrame(time.Second, "1a,Name=F-16C_50,Color=Blue", "2b,Name=Su-27,Color=Red"))
+	h := newHandler(server, map[string]View{hash("blue"): BlueView}, 16)
+	go func() {
+		defer c.unregister(h)
+		h.handle(c)
+	}()
+
+	reader := connect(t, client, "blue")
+	assert.Equal(t, []string{"0,Title=Test", "#1.00"}, readLines(t, reader, 2))
+	assert.Contains(t, readLines(t, reader, 1)[0], "Name=F-16C_50")
+
+	c.broadcast(testFrame(2*time.Second, "2b,T=1|2|3"))
+	destroyed := testFrame(2 * time.Second)
+	destroyed.Events = []*frames.Event{
+		{Type: events.Destroyed, ObjectIDs: []uint64{0x2b}, Text: "Su-27 destroyed"},
+		{
+			Type:      events.Destroyed,
+			ObjectIDs: []uint64{0x2b, 0x1a},
+			Text:      "F-16C_50 destroyed Su-27",
+			Mentions:  []frames.Mention{{ObjectID: 0x1a, Start: 0, End: 8}, {ObjectID: 0x2b, Start: 19, End: 24}},
+		},
+		{Type: events.Destroyed, ObjectIDs: []uint64{0x1a}, Text: "F-16C_50 destroyed"},
+	}
+	c.broadcast(destroyed)
+	c.broadcast(testFrame(2*time.Second, "-2b", "-1a"))
+	assert.Equal(t, []string{
+		"#2.00",
+		"0,Event=Message|1a|F-16C_50 destroyed unknown",
+		"0,Event=Destroyed|1a|F-16C_50 destroyed",
+		"-1a,",
+	}, readLines(t, reader, 4))
+
+	c.broadcast(testFrame(2*time.Second, "3c,Name=MiG-29,Color=Red"))
+	// An object which changes coalition is sent in full when it becomes visible and removed when it becomes hidden.
+	c.broadcast(testFrame(2*time.Second, "3c,Color=Blue"))
+	c.broadcast(testFrame(2*time.Second, "3c,Color=Red"))
+	lines := readLines(t, reader, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "3c,"))
+	assert.Contains(t, lines[0], "Name=MiG-29")
+	assert.Equal(t, "-3c,", lines[1])
+}
+
+func TestResyncKeepsDiscardedRestart(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=One"})
+	h := newTestHandler(server, "", 2)
+	c.register(h)
+
+	c.broadcast(testFrame(time.Second, "1a,Name=F-16C_50"))
+	c.restart(staticInitials{"0,Title=Two"})
+	// The queue is full, so this frame triggers a resynchronization.
+	c.broadcast(testFrame(time.Second, "2b,Name=Su-27"))
+
+	require.Len(t, h.receiver, 1)
+	resync := <-h.receiver
+	require.NotNil(t, resync.restart)
+	assert.Equal(t, []*objects.Update{{ID: 0x1a, IsRemoval: true}}, resync.restart.removals.Updates)
+	assert.Equal(t, staticInitials{"0,Title=Two"}, resync.restart.initials)
+	assert.Equal(t, testFrame(time.Second, "2b,Name=Su-27"), resync.frame)
+}
+
+// listening waits for the server to listen and returns its address.
+func listening(t *testing.T, s *Server) string {
+	t.Helper()
+	var address string
+	require.Eventually(t, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.runtime == nil {
+			return false
+		}
+		address = s.runtime.listener.Addr().String()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return address
+}
+
+func TestServerKeepsClientsBetweenRecordings(t *testing.T) {
+	t.Parallel()
+	s := &Server{Address: "127.0.0.1:0"}
+	defer s.Close()
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstFeed := make(chan *frames.Frame)
+	firstDone := make(chan error)
+	go func() {
+		firstDone <- s.Publish(firstCtx, staticInitials{"0,Title=One"}, firstFeed)
+	}()
+
+	conn, err := net.Dial("tcp", listening(t, s))
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := connect(t, conn, "")
+	assert.Equal(t, []string{"0,Title=One"}, readLines(t, reader, 1))
+	firstFeed <- testFrame(time.Second, "1a,Name=F-16C_50")
+	assert.Equal(t, []string{"#1.00", "1a,Name=F-16C_50"}, readLines(t, reader, 2))
+
+	cancelFirst()
+	require.NoError(t, <-firstDone)
+
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	secondFeed := make(chan *frames.Frame)
+	go func() {
+		_ = s.Publish(secondCtx, staticInitials{"0,Title=Two"}, secondFeed)
+	}()
+	secondFeed <- testFrame(time.Second, "2b,Name=Su-27")
+	assert.Equal(t, []string{
+		"-1a,",
+		"FileType=text/acmi/tacview",
+		"FileVersion=2.2",
+		"0,Title=Two",
+		"#1.00",
+		"2b,Name=Su-27",
+	}, readLines(t, reader, 6))
+
+	require.NoError(t, s.Close())
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServerDisconnectsClientsWhenFeedCloses(t *testing.T) {
+	t.Parallel()
+	s := &Server{Address: "127.0.0.1:0"}
+	defer s.Close()
+
+	feed := make(chan *frames.Frame)
+	done := make(chan error)
+	go func() {
+		done <- s.Publish(context.Background(), staticInitials{"0,Title=Test"}, feed)
+	}()
+	conn, err := net.Dial("tcp", listening(t, s))
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := connect(t, conn, "")
+	readLines(t, reader, 1)
+
+	close(feed)
+	require.ErrorIs(t, <-done, ErrFeedClosed)
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestViewSeesBullseyeMoves(t *testing.T) {
+	t.Parallel()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newClients(ResyncSlowClients, staticInitials{"0,Title=Test", "40000001,Color=Blue", "40000002,Color=Red"})
+	h := newHandler(server, map[string]View{hash("blue"): BlueView}, 16)
+	go func() {
+		defer c.unregister(h)
+		h.handle(c)
+	}()
+
+	reader := connect(t, client, "blue")
+	assert.Equal(t, []string{"0,Title=Test", "40000001,Color=Blue"}, readLines(t, reader, 2))
+
+	// Moving a bullseye changes only its transform.
+	c.broadcast(testFrame(time.Second, "40000001,T=1|2|0", "40000002,T=3|4|0"))
+	c.broadcast(testFrame(2 * time.Second))
+	assert.Equal(t, []string{"#1.00", "40000001,T=1|2|0", "#2.00"}, readLines(t, reader, 3))
+}
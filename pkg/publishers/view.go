@@ -0,0 +1,60 @@
+package publishers
+
+import (
+	"fmt"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/dharmab/goacmi/properties/colors"
+)
+
+// View restricts which objects a real-time telemetry client may see.
+type View string
+
+const (
+	// SpectatorView shows every object.
+	SpectatorView View = "spectator"
+	// BlueView shows blue and neutral objects.
+	BlueView View = "blue"
+	// RedView shows red and neutral objects.
+	RedView View = "red"
+)
+
+// ParseView parses a view from its name.
+func ParseView(s string) (View, error) {
+	switch v := View(s); v {
+	case SpectatorView, BlueView, RedView:
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown view %q", s)
+}
+
+// allowsColor returns true if an object with the given Color property may be shown in the view. Objects are
+// identified by color rather than by ACMI coalition because the color always follows the DCS coalition.
+func (v View) allowsColor(color string) bool {
+	switch v {
+	case BlueView:
+		return color == colors.Blue.String() || color == colors.Grey.String()
+	case RedView:
+		return color == colors.Red.String() || color == colors.Grey.String()
+	}
+	return true
+}
+
+// allows returns true if the object may be shown in the view. The global object is always shown.
+func (v View) allows(object *objects.Object) bool {
+	if object == nil {
+		return v == SpectatorView
+	}
+	if object.ID == objects.GlobalObjectID {
+		return true
+	}
+	color, _ := object.GetProperty(properties.Color)
+	return v.allowsColor(color)
+}
+
+// allowsUpdate returns true if an update which is not part of the world state, such as an initial update, may be shown
+// in the view.
+func (v View) allowsUpdate(update *objects.Update) bool {
+	return v.allows(&objects.Object{ID: update.ID, Properties: update.Properties})
+}
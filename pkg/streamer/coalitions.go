@@ -0,0 +1,55 @@
+package streamer
+
+import (
+	"fmt"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/dharmab/goacmi/properties/coalitions"
+)
+
+// CoalitionMapping maps DCS coalitions to the values of the ACMI Coalition property.
+type CoalitionMapping map[common.Coalition]string
+
+// DefaultCoalitionMapping follows the Tacview convention of blue allies and red enemies.
+var DefaultCoalitionMapping = CoalitionMapping{
+	common.Coalition_COALITION_BLUE:    coalitions.Allies.String(),
+	common.Coalition_COALITION_RED:     coalitions.Enemies.String(),
+	common.Coalition_COALITION_NEUTRAL: coalitions.Neutrals.String(),
+}
+
+// ParseCoalitionMapping parses a mapping from DCS coalition names (blue, red, neutral) to ACMI coalitions. Coalitions
+// which are not given keep their default mapping.
+func ParseCoalitionMapping(names map[string]string) (CoalitionMapping, error) {
+	mapping := CoalitionMapping{}
+	for c, name := range DefaultCoalitionMapping {
+		mapping[c] = name
+	}
+	for key, name := range names {
+		var c common.Coalition
+		switch key {
+		case "blue":
+			c = common.Coalition_COALITION_BLUE
+		case "red":
+			c = common.Coalition_COALITION_RED
+		case "neutral":
+			c = common.Coalition_COALITION_NEUTRAL
+		default:
+			return nil, fmt.Errorf("unknown coalition %q", key)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("ACMI coalition for %s must not be empty", key)
+		}
+		mapping[c] = name
+	}
+	return mapping, nil
+}
+
+// SetCoalitionMapping sets the ACMI coalition of each DCS coalition. It must be called before Stream.
+func (s *Streamer) SetCoalitionMapping(mapping CoalitionMapping) {
+	s.coalitions = mapping
+}
+
+// convertCoalition returns the ACMI coalition of a DCS coalition.
+func (s *Streamer) convertCoalition(c common.Coalition) string {
+	return s.coalitions[c]
+}
@@ -0,0 +1,24 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCoalitionMapping(t *testing.T) {
+	t.Parallel()
+	mapping, err := ParseCoalitionMapping(map[string]string{"red": "Allies", "blue": "Enemies"})
+	require.NoError(t, err)
+	assert.Equal(t, "Allies", mapping[common.Coalition_COALITION_RED])
+	assert.Equal(t, "Enemies", mapping[common.Coalition_COALITION_BLUE])
+	assert.Equal(t, "Neutrals", mapping[common.Coalition_COALITION_NEUTRAL])
+	assert.Equal(t, "Allies", DefaultCoalitionMapping[common.Coalition_COALITION_BLUE])
+
+	_, err = ParseCoalitionMapping(map[string]string{"green": "Allies"})
+	assert.Error(t, err)
+	_, err = ParseCoalitionMapping(map[string]string{"red": ""})
+	assert.Error(t, err)
+}
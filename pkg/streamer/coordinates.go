@@ -0,0 +1,156 @@
+package streamer
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/world"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/rs/zerolog/log"
+)
+
+// Precision is the number of decimal places written for each component of a transform. Trailing zeros are omitted.
+type Precision struct {
+	// LongitudeLatitude is the precision of longitude and latitude offsets in degrees.
+	LongitudeLatitude int
+	// Altitude is the precision of altitude in meters.
+	Altitude int
+	// Attitude is the precision of roll, pitch, yaw and heading in degrees.
+	Attitude int
+	// Native is the precision of the native U and V coordinates in meters.
+	Native int
+}
+
+// DefaultPrecision is precise to about a centimeter and a tenth of a degree.
+var DefaultPrecision = Precision{LongitudeLatitude: 7, Altitude: 2, Attitude: 1, Native: 2}
+
+// SetPrecision sets the precision of transforms. It must be called before Stream.
+func (s *Streamer) SetPrecision(precision Precision) {
+	s.precision = precision
+}
+
+// theatreReferences maps DCS theatres to reference points near their centers, as longitude and latitude in whole
+// degrees.
+var theatreReferences = map[string][2]float64{
+	"Afghanistan":    {66, 33},
+	"Caucasus":       {41, 43},
+	"Falklands":      {-60, -52},
+	"GermanyCW":      {10, 51},
+	"Iraq":           {44, 33},
+	"Kola":           {30, 68},
+	"MarianaIslands": {145, 15},
+	"Nevada":         {-115, 36},
+	"Normandy":       {0, 49},
+	"PersianGulf":    {56, 26},
+	"SinaiMap":       {33, 30},
+	"Syria":          {37, 35},
+	"TheChannel":     {1, 51},
+}
+
+// reference is the point which transforms are written relative to.
+type reference struct {
+	longitude float64
+	latitude  float64
+	// set is false until the reference point has been chosen.
+	set bool
+}
+
+// theatreTimeout bounds how long resolveReference waits for the mission's theatre.
+const theatreTimeout = 10 * time.Second
+
+// resolveReference chooses the reference point from the mission's theatre. If the theatre is unknown, the reference
+// point is chosen from the first transform which is written instead. That object differs between runs of the same
+// mission, so recordings of an unknown theatre cannot be resumed. It is used when streaming starts and when the mission
+// changes. Payloads built relative to the previous reference point are discarded by forward.
+func (s *Streamer) resolveReference(ctx context.Context) {
+	ref := reference{}
+	theatreCtx, cancel := context.WithTimeout(ctx, theatreTimeout)
+	defer cancel()
+	resp, err := s.worldServiceClient.GetTheatre(theatreCtx, &world.GetTheatreRequest{})
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get theatre, reference point will be chosen from the first object and recordings cannot be resumed")
+	} else if point, ok := theatreReferences[resp.GetTheatre()]; ok {
+		ref = reference{longitude: point[0], latitude: point[1], set: true}
+	} else {
+		log.Warn().Str("theatre", resp.GetTheatre()).Msg("unknown theatre, reference point will be chosen from the first object and recordings cannot be resumed")
+	}
+
+	s.referenceLock.Lock()
+	defer s.referenceLock.Unlock()
+	s.reference = ref
+	s.referenceGeneration++
+}
+
+// currentReference returns the generation of the reference point. A payload is stamped with the generation read before
+// it was built.
+func (s *Streamer) currentReference() uint64 {
+	s.referenceLock.Lock()
+	defer s.referenceLock.Unlock()
+	return s.referenceGeneration
+}
+
+// referencePoint returns the reference longitude and latitude. If no reference point has been chosen, it is fixed at
+// zero, so that it can be written to the global properties before any transform.
+func (s *Streamer) referencePoint() (float64, float64) {
+	s.referenceLock.Lock()
+	defer s.referenceLock.Unlock()
+	s.reference.set = true
+	return s.reference.longitude, s.reference.latitude
+}
+
+// transform formats coordinates relative to the reference point, at the configured precision. If no reference point
+// has been chosen, the whole degrees of these coordinates become the reference point.
+func (s *Streamer) transform(c *objects.Coordinates) string {
+	s.referenceLock.Lock()
+	if !s.reference.set && c.Longitude != nil && c.Latitude != nil {
+		s.reference = reference{longitude: math.Round(*c.Longitude), latitude: math.Round(*c.Latitude), set: true}
+		log.Info().Float64("longitude", s.reference.longitude).Float64("latitude", s.reference.latitude).Msg("chose reference point")
+	}
+	ref := s.reference
+	s.referenceLock.Unlock()
+
+	fields := make([]string, 9)
+	if c.Longitude != nil {
+		fields[0] = formatDecimal(*c.Longitude-ref.longitude, s.precision.LongitudeLatitude)
+	}
+	if c.Latitude != nil {
+		fields[1] = formatDecimal(*c.Latitude-ref.latitude, s.precision.LongitudeLatitude)
+	}
+	if c.Altitude != nil {
+		fields[2] = formatDecimal(c.Altitude.Meters(), s.precision.Altitude)
+	}
+	if c.Roll != nil {
+		fields[3] = formatDecimal(c.Roll.Degrees(), s.precision.Attitude)
+	}
+	if c.Pitch != nil {
+		fields[4] = formatDecimal(c.Pitch.Degrees(), s.precision.Attitude)
+	}
+	if c.Yaw != nil {
+		fields[5] = formatDecimal(c.Yaw.Degrees(), s.precision.Attitude)
+	}
+	if c.X != nil {
+		fields[6] = formatDecimal(*c.X, s.precision.Native)
+	}
+	if c.Y != nil {
+		fields[7] = formatDecimal(*c.Y, s.precision.Native)
+	}
+	if c.Heading != nil {
+		fields[8] = formatDecimal(c.Heading.Degrees(), s.precision.Attitude)
+	}
+	return strings.Join(fields, "|")
+}
+
+// formatDecimal formats a number with at most the given number of decimal places, without trailing zeros.
+func formatDecimal(value float64, precision int) string {
+	formatted := strconv.FormatFloat(value, 'f', precision, 64)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	if formatted == "-0" {
+		return "0"
+	}
+	return formatted
+}
@@ -0,0 +1,93 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/world"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	measure "github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestTransformIsRelativeToReferencePoint(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{precision: Precision{LongitudeLatitude: 5, Altitude: 1, Attitude: 0, Native: 0}}
+	lon, lat := 41.6123456, 42.1765432
+	altitude := 1524.06 * measure.Meter
+	heading := 90.4 * measure.Degree
+	u, v := -281000.25, 647000.75
+	coordinates := objects.NewCoordinates(&lon, &lat, &altitude, &u, &v, nil, nil, nil, &heading)
+
+	// Without a known theatre, the first transform chooses the reference point.
+	assert.Equal(t, "-0.38765|0.17654|1524.1||||-281000|647001|90", s.transform(coordinates))
+	longitude, latitude := s.referencePoint()
+	assert.InDelta(t, 42, longitude, 1e-9)
+	assert.InDelta(t, 42, latitude, 1e-9)
+}
+
+func TestFormatDecimal(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "1.5", formatDecimal(1.5, 3))
+	assert.Equal(t, "2", formatDecimal(1.999, 2))
+	assert.Equal(t, "0", formatDecimal(-0.0001, 2))
+	assert.Equal(t, "120", formatDecimal(120, 0))
+}
+
+// theatreClient returns a theatre once it is released.
+type theatreClient struct {
+	world.WorldServiceClient
+	requested chan struct{}
+	release   chan struct{}
+}
+
+func (c *theatreClient) GetTheatre(ctx context.Context, _ *world.GetTheatreRequest, _ ...grpc.CallOption) (*world.GetTheatreResponse, error) {
+	close(c.requested)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.release:
+		return &world.GetTheatreResponse{Theatre: "Caucasus"}, nil
+	}
+}
+
+func TestResolveReferenceDiscardsStalePayloads(t *testing.T) {
+	t.Parallel()
+	client := &theatreClient{requested: make(chan struct{}), release: make(chan struct{})}
+	s := &Streamer{worldServiceClient: client, precision: DefaultPrecision}
+	lon, lat := 10.5, 51.5
+	coordinates := objects.NewCoordinates(&lon, &lat, nil, nil, nil, nil, nil, nil, nil)
+	stale := Payload{
+		Update:    &objects.Update{ID: 0x1, Properties: map[string]string{properties.Transform: s.transform(coordinates)}},
+		reference: s.currentReference(),
+	}
+
+	resolved := make(chan struct{})
+	go func() {
+		defer close(resolved)
+		s.resolveReference(context.Background())
+	}()
+	<-client.requested
+	// Transforms are still written while the theatre is read.
+	assert.Equal(t, "-0.5|-0.5|||||||", s.transform(coordinates))
+	close(client.release)
+	<-resolved
+	longitude, latitude := s.referencePoint()
+	assert.InDelta(t, 41, longitude, 1e-9)
+	assert.InDelta(t, 43, latitude, 1e-9)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queued := make(chan Payload)
+	updates := make(chan Payload)
+	go s.forward(ctx, queued, updates)
+	current := Payload{
+		Update:    &objects.Update{ID: 0x1, Properties: map[string]string{properties.Transform: s.transform(coordinates)}},
+		reference: s.currentReference(),
+	}
+	queued <- stale
+	queued <- current
+	assert.Equal(t, current, <-updates)
+}
@@ -0,0 +1,305 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/rs/zerolog/log"
+)
+
+// countryPollInterval is how often the countries of new units are read.
+const countryPollInterval = time.Second
+
+// countriesResult is the result of unitCountriesLua and staticCountriesLua.
+type countriesResult struct {
+	Time      float64         `json:"time"`
+	Countries json.RawMessage `json:"countries"`
+}
+
+// unitCountriesLua is evaluated in the mission scripting environment to read the countries of units. The %s verb is
+// replaced with a table of unit names keyed by unit ID. Countries are returned as country.id values from the DCS
+// scripting engine.
+const unitCountriesLua = `
+local names = %s
+local countries = {}
+for id, name in pairs(names) do
+	local unit = Unit.getByName(name)
+	if unit ~= nil and unit:isExist() then
+		countries[id] = unit:getCountry()
+	end
+end
+return { time = timer.getTime(), countries = countries }
+`
+
+// staticCountriesLua is evaluated in the mission scripting environment to read the countries of static objects and
+// airbases. The first %s verb is replaced with a table of static object names, and the second with a table of airbase
+// names, both keyed by object ID.
+const staticCountriesLua = `
+local statics = %s
+local airbases = %s
+local countries = {}
+for id, name in pairs(statics) do
+	local object = StaticObject.getByName(name)
+	if object ~= nil and object:isExist() then
+		countries[id] = object:getCountry()
+	end
+end
+for id, name in pairs(airbases) do
+	local airbase = Airbase.getByName(name)
+	if airbase ~= nil then
+		countries[id] = airbase:getCountry()
+	end
+end
+return { time = timer.getTime(), countries = countries }
+`
+
+// countryCodes maps DCS countries to ISO 3166-1 alpha-2 codes. Countries which are not real nations, such as the
+// Aggressors and the Combined Joint Task Forces, have no code. Neither do countries which no longer exist, such as
+// Yugoslavia and the Soviet Union, because their codes have been withdrawn.
+var countryCodes = map[common.Country]string{
+	common.Country_COUNTRY_RUSSIA:                   "ru",
+	common.Country_COUNTRY_UKRAINE:                  "ua",
+	common.Country_COUNTRY_UNITED_STATES_OF_AMERICA: "us",
+	common.Country_COUNTRY_TURKEY:                   "tr",
+	common.Country_COUNTRY_UNITED_KINGDOM:           "gb",
+	common.Country_COUNTRY_FRANCE:                   "fr",
+	common.Country_COUNTRY_GERMANY:                  "de",
+	common.Country_COUNTRY_CANADA:                   "ca",
+	common.Country_COUNTRY_SPAIN:                    "es",
+	common.Country_COUNTRY_THE_NETHERLANDS:          "nl",
+	common.Country_COUNTRY_BELGIUM:                  "be",
+	common.Country_COUNTRY_NORWAY:                   "no",
+	common.Country_COUNTRY_DENMARK:                  "dk",
+	common.Country_COUNTRY_ISRAEL:                   "il",
+	common.Country_COUNTRY_GEORGIA:                  "ge",
+	common.Country_COUNTRY_ITALY:                    "it",
+	common.Country_COUNTRY_AUSTRALIA:                "au",
+	common.Country_COUNTRY_SWITZERLAND:              "ch",
+	common.Country_COUNTRY_AUSTRIA:                  "at",
+	common.Country_COUNTRY_BELARUS:                  "by",
+	common.Country_COUNTRY_BULGARIA:                 "bg",
+	common.Country_COUNTRY_CZECH_REPUBLIC:           "cz",
+	common.Country_COUNTRY_CHINA:                    "cn",
+	common.Country_COUNTRY_CROATIA:                  "hr",
+	common.Country_COUNTRY_EGYPT:                    "eg",
+	common.Country_COUNTRY_FINLAND:                  "fi",
+	common.Country_COUNTRY_GREECE:                   "gr",
+	common.Country_COUNTRY_HUNGARY:                  "hu",
+	common.Country_COUNTRY_INDIA:                    "in",
+	common.Country_COUNTRY_IRAN:                     "ir",
+	common.Country_COUNTRY_IRAQ:                     "iq",
+	common.Country_COUNTRY_JAPAN:                    "jp",
+	common.Country_COUNTRY_KAZAKHSTAN:               "kz",
+	common.Country_COUNTRY_NORTH_KOREA:              "kp",
+	common.Country_COUNTRY_PAKISTAN:                 "pk",
+	common.Country_COUNTRY_POLAND:                   "pl",
+	common.Country_COUNTRY_ROMANIA:                  "ro",
+	common.Country_COUNTRY_SAUDI_ARABIA:             "sa",
+	common.Country_COUNTRY_SERBIA:                   "rs",
+	common.Country_COUNTRY_SLOVAKIA:                 "sk",
+	common.Country_COUNTRY_SOUTH_KOREA:              "kr",
+	common.Country_COUNTRY_SWEDEN:                   "se",
+	common.Country_COUNTRY_SYRIA:                    "sy",
+	common.Country_COUNTRY_YEMEN:                    "ye",
+	common.Country_COUNTRY_VIETNAM:                  "vn",
+	common.Country_COUNTRY_VENEZUELA:                "ve",
+	common.Country_COUNTRY_TUNISIA:                  "tn",
+	common.Country_COUNTRY_THAILAND:                 "th",
+	common.Country_COUNTRY_SUDAN:                    "sd",
+	common.Country_COUNTRY_PHILIPPINES:              "ph",
+	common.Country_COUNTRY_MOROCCO:                  "ma",
+	common.Country_COUNTRY_MEXICO:                   "mx",
+	common.Country_COUNTRY_MALAYSIA:                 "my",
+	common.Country_COUNTRY_LIBYA:                    "ly",
+	common.Country_COUNTRY_JORDAN:                   "jo",
+	common.Country_COUNTRY_INDONESIA:                "id",
+	common.Country_COUNTRY_HONDURAS:                 "hn",
+	common.Country_COUNTRY_ETHIOPIA:                 "et",
+	common.Country_COUNTRY_CHILE:                    "cl",
+	common.Country_COUNTRY_BRAZIL:                   "br",
+	common.Country_COUNTRY_BAHRAIN:                  "bh",
+	common.Country_COUNTRY_ALGERIA:                  "dz",
+	common.Country_COUNTRY_KUWAIT:                   "kw",
+	common.Country_COUNTRY_QATAR:                    "qa",
+	common.Country_COUNTRY_OMAN:                     "om",
+	common.Country_COUNTRY_UNITED_ARAB_EMIRATES:     "ae",
+	common.Country_COUNTRY_SOUTH_AFRICA:             "za",
+	common.Country_COUNTRY_CUBA:                     "cu",
+	common.Country_COUNTRY_PORTUGAL:                 "pt",
+	common.Country_COUNTRY_LEBANON:                  "lb",
+	common.Country_COUNTRY_ARGENTINA:                "ar",
+	common.Country_COUNTRY_CYPRUS:                   "cy",
+	common.Country_COUNTRY_SLOVENIA:                 "si",
+}
+
+// countryCode returns the ISO code of a country.id value from the DCS scripting engine. DCS-gRPC numbers countries from
+// one, leaving zero as unspecified, while the scripting engine numbers them from zero.
+func countryCode(scriptingCountry int) (string, bool) {
+	code, ok := countryCodes[common.Country(scriptingCountry+1)]
+	return code, ok
+}
+
+// unitCountry returns the cached country code of a unit. If the unit's country has not been read, the unit is queued
+// so that its country is read by streamCountries.
+func (s *Streamer) unitCountry(id uint32, name string) (string, bool) {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	code, ok := s.countries[id]
+	if !ok && name != "" {
+		s.pendingCountries[id] = name
+	}
+	return code, ok && code != ""
+}
+
+// streamCountries reads the countries of queued units, and sends an update for each unit with a country code.
+func (s *Streamer) streamCountries(ctx context.Context, updates chan<- Payload) {
+	ticker := time.NewTicker(countryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reference := s.currentReference()
+			payloads, err := s.pollCountries(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to poll unit countries")
+				continue
+			}
+			for _, payload := range payloads {
+				payload.reference = reference
+				if !send(ctx, updates, payload) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pollCountries evaluates unitCountriesLua for the queued units and caches the result. Units which were not found are
+// removed from the queue, and are queued again when they are next updated.
+func (s *Streamer) pollCountries(ctx context.Context) ([]Payload, error) {
+	s.unitsLock.Lock()
+	entries := make([]string, 0, len(s.pendingCountries))
+	for id, name := range s.pendingCountries {
+		entries = append(entries, fmt.Sprintf("[%q] = %s", strconv.FormatUint(uint64(id), 10), luaString(name)))
+	}
+	s.pendingCountries = make(map[uint32]string)
+	s.unitsLock.Unlock()
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	lua := fmt.Sprintf(unitCountriesLua, "{ "+strings.Join(entries, ", ")+" }")
+	resp, err := s.customServiceClient.Eval(ctx, &custom.EvalRequest{Lua: lua})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate unit countries script: %w", err)
+	}
+	var result countriesResult
+	if err := json.Unmarshal([]byte(resp.GetJson()), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode unit countries script result: %w", err)
+	}
+	countries := make(map[string]int)
+	// An empty Lua table may be encoded as either an empty JSON object or an empty JSON array.
+	if raw := bytes.TrimSpace(result.Countries); len(raw) > 0 && !bytes.Equal(raw, []byte("[]")) {
+		if err := json.Unmarshal(raw, &countries); err != nil {
+			return nil, fmt.Errorf("failed to decode unit countries: %w", err)
+		}
+	}
+
+	missionTime := toMissionTime(result.Time)
+	payloads := make([]Payload, 0, len(countries))
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	for key, country := range countries {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		// Units which were removed while their country was read are skipped, so that they are not created again.
+		if _, ok := s.units[uint32(id)]; !ok {
+			continue
+		}
+		code, _ := countryCode(country)
+		s.countries[uint32(id)] = code
+		if code == "" {
+			continue
+		}
+		payloads = append(payloads, Payload{
+			Update: &objects.Update{
+				ID:         id,
+				Properties: map[string]string{properties.Country: code},
+			},
+			MissionTime: missionTime,
+		})
+	}
+	return payloads, nil
+}
+
+// staticCountries evaluates staticCountriesLua for the given static objects and airbases, whose names are keyed by
+// object ID. Returns the country code of each object whose country has one.
+func (s *Streamer) staticCountries(ctx context.Context, statics, airbases map[uint64]string) (map[uint64]string, error) {
+	lua := fmt.Sprintf(staticCountriesLua, luaNameTable(statics), luaNameTable(airbases))
+	resp, err := s.customServiceClient.Eval(ctx, &custom.EvalRequest{Lua: lua})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate static countries script: %w", err)
+	}
+	var result countriesResult
+	if err := json.Unmarshal([]byte(resp.GetJson()), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode static countries script result: %w", err)
+	}
+	countries := make(map[string]int)
+	// An empty Lua table may be encoded as either an empty JSON object or an empty JSON array.
+	if raw := bytes.TrimSpace(result.Countries); len(raw) > 0 && !bytes.Equal(raw, []byte("[]")) {
+		if err := json.Unmarshal(raw, &countries); err != nil {
+			return nil, fmt.Errorf("failed to decode static countries: %w", err)
+		}
+	}
+
+	codes := make(map[uint64]string, len(countries))
+	for key, country := range countries {
+		id, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		if code, ok := countryCode(country); ok {
+			codes[id] = code
+		}
+	}
+	return codes, nil
+}
+
+// luaNameTable formats names as a Lua table keyed by object ID.
+func luaNameTable(names map[uint64]string) string {
+	entries := make([]string, 0, len(names))
+	for id, name := range names {
+		entries = append(entries, fmt.Sprintf("[%q] = %s", strconv.FormatUint(id, 10), luaString(name)))
+	}
+	return "{ " + strings.Join(entries, ", ") + " }"
+}
+
+// luaString quotes a string as a Lua string literal. Characters other than printable ASCII are written as decimal
+// escapes, which every version of Lua understands.
+func luaString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c < 0x7f && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%03d", c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
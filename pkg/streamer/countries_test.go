@@ -0,0 +1,50 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryCode(t *testing.T) {
+	t.Parallel()
+	// The scripting engine numbers countries from zero, starting with Russia.
+	code, ok := countryCode(0)
+	assert.True(t, ok)
+	assert.Equal(t, "ru", code)
+	code, ok = countryCode(2)
+	assert.True(t, ok)
+	assert.Equal(t, "us", code)
+	_, ok = countryCode(7)
+	assert.False(t, ok, "Aggressors have no country code")
+	for _, country := range []common.Country{
+		common.Country_COUNTRY_YUGOSLAVIA,
+		common.Country_COUNTRY_SOVIET_UNION,
+		common.Country_COUNTRY_GERMAN_DEMOCRATIC_REPUBLIC,
+	} {
+		_, ok = countryCode(int(country) - 1)
+		assert.False(t, ok, "%s has a withdrawn country code", country)
+	}
+}
+
+func TestStaticCountries(t *testing.T) {
+	t.Parallel()
+	client := &evalClient{result: `{"time": 1, "countries": {"16": 0, "4294967297": 2, "17": 7}}`}
+	s := &Streamer{customServiceClient: client}
+	codes, err := s.staticCountries(
+		context.Background(),
+		map[uint64]string{0x10: "Bunker", 0x11: "Aggressor Tent"},
+		map[uint64]string{0x100000001: "Kutaisi"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint64]string{0x10: "ru", 0x100000001: "us"}, codes)
+}
+
+func TestLuaString(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, `"Enfield 1-1"`, luaString("Enfield 1-1"))
+	assert.Equal(t, `"a\034b\092c\195\169"`, luaString("a\"b\\cé"))
+}
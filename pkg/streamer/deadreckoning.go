@@ -0,0 +1,201 @@
+package streamer
+
+import (
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	measure "github.com/martinlindhe/unit"
+)
+
+// DeadReckoning configures the suppression of transforms which can be predicted. Each object's position and attitude
+// are extrapolated from the last two transforms which were sent for it, and a new transform is sent only when the
+// reported position or attitude differs from the prediction by more than a threshold, or when no transform has been
+// sent for MaxSilence.
+type DeadReckoning struct {
+	// PositionThreshold is the horizontal distance from the predicted position beyond which a transform is sent.
+	PositionThreshold measure.Length
+	// AltitudeThreshold is the difference from the predicted altitude beyond which a transform is sent.
+	AltitudeThreshold measure.Length
+	// AttitudeThreshold is the difference from the predicted roll, pitch or heading beyond which a transform is sent.
+	AttitudeThreshold measure.Angle
+	// MaxSilence is the longest mission time for which an object's transform may be suppressed.
+	MaxSilence time.Duration
+}
+
+// EnableDeadReckoning suppresses transforms which can be predicted, as configured. It must be called before Stream.
+func (s *Streamer) EnableDeadReckoning(config DeadReckoning) {
+	s.deadReckoner = &deadReckoner{config: config, reports: make(map[uint64][]report)}
+}
+
+// suppress removes a predictable transform from a payload's update. Returns false if nothing remains to be sent.
+func (s *Streamer) suppress(payload Payload) (Payload, bool) {
+	if s.deadReckoner == nil {
+		return payload, true
+	}
+	return s.deadReckoner.filter(payload)
+}
+
+// report is a transform which was sent for an object.
+type report struct {
+	time time.Duration
+	// u and v are the object's native coordinates in meters.
+	u, v float64
+	// altitude is in meters.
+	altitude float64
+	// roll, pitch and heading are in degrees.
+	roll, pitch, heading float64
+}
+
+// deadReckoner tracks the transforms sent for each object.
+type deadReckoner struct {
+	config DeadReckoning
+	lock   sync.Mutex
+	// reports maps object IDs to the last two reports sent for them, oldest first.
+	reports map[uint64][]report
+}
+
+func (d *deadReckoner) filter(payload Payload) (Payload, bool) {
+	update := payload.Update
+	if update == nil {
+		return payload, true
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if update.IsRemoval {
+		delete(d.reports, update.ID)
+		return payload, true
+	}
+	actual, ok := parseReport(payload.MissionTime, update.Properties[properties.Transform])
+	if !ok {
+		return payload, true
+	}
+
+	sent := d.reports[update.ID]
+	if len(sent) > 0 {
+		last := sent[len(sent)-1]
+		// Reports which are older than the last report sent, such as those from a slower stream, are passed through
+		// without affecting the prediction.
+		if actual.time <= last.time {
+			return payload, true
+		}
+		if !d.diverged(sent, actual) {
+			return withoutTransform(payload)
+		}
+	}
+	d.reports[update.ID] = append(sent[max(0, len(sent)-1):], actual)
+	return payload, true
+}
+
+// withoutTransform returns a copy of a payload whose update has no transform. Returns false if the update has no other
+// properties.
+func withoutTransform(payload Payload) (Payload, bool) {
+	update := payload.Update
+	if len(update.Properties) == 1 {
+		return payload, false
+	}
+	stripped := &objects.Update{ID: update.ID, Properties: maps.Clone(update.Properties)}
+	delete(stripped.Properties, properties.Transform)
+	payload.Update = stripped
+	return payload, true
+}
+
+// diverged returns true if the actual report differs from the prediction made from the sent reports by more than a
+// threshold, or if the silence period has elapsed.
+func (d *deadReckoner) diverged(sent []report, actual report) bool {
+	last := sent[len(sent)-1]
+	if actual.time-last.time >= d.config.MaxSilence {
+		return true
+	}
+	predicted := last
+	if len(sent) == 2 {
+		predicted = extrapolate(sent[0], last, actual.time)
+	}
+	if math.Hypot(actual.u-predicted.u, actual.v-predicted.v) > d.config.PositionThreshold.Meters() {
+		return true
+	}
+	if math.Abs(actual.altitude-predicted.altitude) > d.config.AltitudeThreshold.Meters() {
+		return true
+	}
+	threshold := d.config.AttitudeThreshold.Degrees()
+	for _, pair := range [][2]float64{
+		{actual.roll, predicted.roll},
+		{actual.pitch, predicted.pitch},
+		{actual.heading, predicted.heading},
+	} {
+		if math.Abs(angleDifference(pair[0], pair[1])) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// reset forgets every object. It is used when the mission changes.
+func (d *deadReckoner) reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.reports = make(map[uint64][]report)
+}
+
+// extrapolate predicts the report at the given time by linear extrapolation from two earlier reports.
+func extrapolate(first, second report, t time.Duration) report {
+	if second.time <= first.time {
+		return second
+	}
+	ratio := float64(t-second.time) / float64(second.time-first.time)
+	linear := func(a, b float64) float64 {
+		return b + (b-a)*ratio
+	}
+	angular := func(a, b float64) float64 {
+		return b + angleDifference(b, a)*ratio
+	}
+	return report{
+		time:     t,
+		u:        linear(first.u, second.u),
+		v:        linear(first.v, second.v),
+		altitude: linear(first.altitude, second.altitude),
+		roll:     angular(first.roll, second.roll),
+		pitch:    angular(first.pitch, second.pitch),
+		heading:  angular(first.heading, second.heading),
+	}
+}
+
+// angleDifference returns the signed difference a - b in degrees, normalized to [-180, 180).
+func angleDifference(a, b float64) float64 {
+	return math.Mod(math.Mod(a-b+180, 360)+360, 360) - 180
+}
+
+// parseReport parses a complete transform with nine components, as produced by the streamer. Returns false if the
+// transform is missing or incomplete.
+func parseReport(t time.Duration, transform string) (report, bool) {
+	fields := strings.Split(transform, "|")
+	if len(fields) != 9 {
+		return report{}, false
+	}
+	// The components are longitude, latitude, altitude, roll, pitch, yaw, u, v and heading.
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		if i < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return report{}, false
+		}
+		values[i] = value
+	}
+	return report{
+		time:     t,
+		altitude: values[2],
+		roll:     values[3],
+		pitch:    values[4],
+		u:        values[6],
+		v:        values[7],
+		heading:  values[8],
+	}, true
+}
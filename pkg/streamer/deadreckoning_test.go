@@ -0,0 +1,67 @@
+package streamer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	measure "github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transformPayload(missionTime time.Duration, u, heading float64) Payload {
+	return Payload{
+		Update: &objects.Update{ID: 0x1a, Properties: map[string]string{
+			properties.Transform: fmt.Sprintf("1|2|1000|0|0|0|%f|500|%f", u, heading),
+			properties.Name:      "F-16C_50",
+		}},
+		MissionTime: missionTime,
+	}
+}
+
+func TestDeadReckoningSuppressesPredictableTransforms(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{}
+	s.EnableDeadReckoning(DeadReckoning{
+		PositionThreshold: 5 * measure.Meter,
+		AltitudeThreshold: 5 * measure.Meter,
+		AttitudeThreshold: 2 * measure.Degree,
+		MaxSilence:        10 * time.Second,
+	})
+	sent := func(missionTime time.Duration, u, heading float64) bool {
+		payload, ok := s.suppress(transformPayload(missionTime, u, heading))
+		require.True(t, ok)
+		_, ok = payload.Update.Properties[properties.Transform]
+		return ok
+	}
+
+	// The first two reports establish a velocity of 100 m/s.
+	assert.True(t, sent(1*time.Second, 0, 90))
+	assert.True(t, sent(2*time.Second, 100, 90))
+	// These reports match the extrapolated position.
+	assert.False(t, sent(3*time.Second, 201, 90))
+	assert.False(t, sent(4*time.Second, 299, 90))
+	// The object turned.
+	assert.True(t, sent(5*time.Second, 400, 100))
+
+	// A stationary object is sent again once the silence period elapses.
+	assert.True(t, sent(7*time.Second, 0, 0))
+	assert.True(t, sent(8*time.Second, 0, 0))
+	assert.False(t, sent(17*time.Second, 0, 0))
+	assert.True(t, sent(18*time.Second, 0, 0))
+
+	removal, ok := s.suppress(Payload{Update: &objects.Update{ID: 0x1a, IsRemoval: true}})
+	require.True(t, ok)
+	assert.True(t, removal.Update.IsRemoval)
+	assert.True(t, sent(19*time.Second, 0, 0))
+}
+
+func TestAngleDifference(t *testing.T) {
+	t.Parallel()
+	assert.InDelta(t, 20, angleDifference(10, 350), 1e-9)
+	assert.InDelta(t, -20, angleDifference(350, 10), 1e-9)
+	assert.InDelta(t, 0, angleDifference(360, 0), 1e-9)
+}
@@ -0,0 +1,302 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties/events"
+	"github.com/rs/zerolog/log"
+)
+
+// eventsRetryInterval is how long to wait before resubscribing to the event stream after it ends.
+const eventsRetryInterval = 5 * time.Second
+
+func (s *Streamer) streamEvents(ctx context.Context, updates chan<- Payload) {
+	for {
+		nextAttempt := time.Now().Add(eventsRetryInterval)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			log.Info().Msg("creating new event stream")
+			stream, err := s.missionServiceClient.StreamEvents(ctx, &mission.StreamEventsRequest{})
+			if err != nil {
+				log.Error().Err(err).Msg("failed to stream events")
+			} else {
+				log.Info().Msg("receiving events from stream")
+				s.receiveEventStream(ctx, stream, updates)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(nextAttempt)):
+			}
+		}
+	}
+}
+
+func (s *Streamer) receiveEventStream(ctx context.Context, stream mission.MissionService_StreamEventsClient, updates chan<- Payload) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			response, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("received error from events stream")
+				return
+			}
+			s.handleEvent(ctx, response, updates)
+		}
+	}
+}
+
+func (s *Streamer) handleEvent(ctx context.Context, response *mission.StreamEventsResponse, updates chan<- Payload) {
+	missionTime := toMissionTime(response.GetTime())
+	if response.GetMissionStart() != nil || response.GetMissionEnd() != nil {
+		log.Info().Msg("mission started or stopped")
+		s.resetWeapons()
+		s.resetUnits()
+		s.resolveReference(ctx)
+		send(ctx, updates, Payload{MissionTime: missionTime, MissionChanged: true})
+		return
+	}
+	reference := s.currentReference()
+	for _, payload := range s.buildEventPayloads(response) {
+		payload.MissionTime = missionTime
+		payload.reference = reference
+		if !send(ctx, updates, payload) {
+			return
+		}
+	}
+}
+
+// buildEventPayloads translates a DCS-gRPC mission event into object updates and recording events. Events which have no
+// ACMI equivalent produce no payloads. The mission time of the payloads is not set.
+func (s *Streamer) buildEventPayloads(response *mission.StreamEventsResponse) []Payload {
+	var result []Payload
+	appendIfPresent := func(update *objects.Update) {
+		if update != nil {
+			result = append(result, Payload{Update: update})
+		}
+	}
+	appendEvent := func(event *frames.Event) {
+		result = append(result, Payload{Event: event})
+	}
+
+	if shot := response.GetShot(); shot != nil {
+		appendIfPresent(s.trackWeapon(shot))
+	} else if hit := response.GetHit(); hit != nil {
+		if weapon := hit.GetWeapon(); weapon != nil {
+			appendIfPresent(s.untrackWeapon(weapon.GetId()))
+		}
+		text := (&eventText{}).initiator(hit.GetInitiator()).write(" hit ").target(hit.GetTarget())
+		text.weapon(hit.GetWeapon(), hit.WeaponName)
+		appendEvent(buildEvent(events.Message, text, initiatorID(hit.GetInitiator()), targetID(hit.GetTarget())))
+	} else if kill := response.GetKill(); kill != nil {
+		text := (&eventText{}).initiator(kill.GetInitiator()).write(" destroyed ").target(kill.GetTarget())
+		text.weapon(kill.GetWeapon(), kill.WeaponName)
+		appendEvent(buildEvent(events.Destroyed, text, targetID(kill.GetTarget()), initiatorID(kill.GetInitiator())))
+		// Static objects are exported once rather than streamed, so they are removed when they are destroyed.
+		if static := kill.GetTarget().GetStatic(); static != nil {
+			appendIfPresent(s.untrackStatic(static.GetId()))
+		}
+	} else if dead := response.GetDead(); dead != nil {
+		if static := dead.GetInitiator().GetStatic(); static != nil {
+			appendIfPresent(s.untrackStatic(static.GetId()))
+		}
+	} else if takeoff := response.GetTakeoff(); takeoff != nil {
+		text := (&eventText{}).initiator(takeoff.GetInitiator()).write(" has taken off")
+		if place := takeoff.GetPlace(); place != nil {
+			text.write(" from ").airbase(place)
+		}
+		appendEvent(buildEvent(events.TakenOff, text, initiatorID(takeoff.GetInitiator())))
+	} else if land := response.GetLand(); land != nil {
+		text := (&eventText{}).initiator(land.GetInitiator()).write(" has landed")
+		if place := land.GetPlace(); place != nil {
+			text.write(" at ").airbase(place)
+		}
+		appendEvent(buildEvent(events.LandedEvent, text, initiatorID(land.GetInitiator())))
+	} else if crash := response.GetCrash(); crash != nil {
+		text := (&eventText{}).initiator(crash.GetInitiator()).write(" has crashed")
+		appendEvent(buildEvent(events.Destroyed, text, initiatorID(crash.GetInitiator())))
+	} else if ejection := response.GetEjection(); ejection != nil {
+		text := (&eventText{}).initiator(ejection.GetInitiator()).write(" has ejected")
+		appendEvent(buildEvent(events.Message, text, initiatorID(ejection.GetInitiator())))
+	} else if pilotDead := response.GetPilotDead(); pilotDead != nil {
+		text := (&eventText{}).write("The pilot of ").initiator(pilotDead.GetInitiator()).write(" has died")
+		appendEvent(buildEvent(events.Message, text, initiatorID(pilotDead.GetInitiator())))
+	} else if capture := response.GetBaseCapture(); capture != nil {
+		result = append(result, s.buildCapturePayloads(capture)...)
+	} else if birth := response.GetBirth(); birth != nil {
+		text := (&eventText{}).initiator(birth.GetInitiator()).write(" has spawned")
+		if place := birth.GetPlace(); place != nil {
+			text.write(" at ").airbase(place)
+		}
+		appendEvent(buildEvent(events.Message, text, initiatorID(birth.GetInitiator())))
+	}
+	return result
+}
+
+// buildEvent builds a recording event. Object IDs which are zero are omitted.
+func buildEvent(event events.Event, text *eventText, ids ...uint32) *frames.Event {
+	result := &frames.Event{Type: event, Text: text.String(), Mentions: text.mentions}
+	for _, id := range ids {
+		if id != 0 {
+			result.ObjectIDs = append(result.ObjectIDs, uint64(id))
+		}
+	}
+	return result
+}
+
+// eventText builds the text of an event, recording which parts of it name objects so that they can be removed for
+// clients which cannot see those objects.
+type eventText struct {
+	strings.Builder
+	mentions []frames.Mention
+}
+
+// write appends text which does not name an object.
+func (t *eventText) write(text string) *eventText {
+	t.WriteString(text)
+	return t
+}
+
+// name appends the name of an object. Names of objects without an ID are written as plain text.
+func (t *eventText) name(id uint64, name string) *eventText {
+	start := t.Len()
+	t.WriteString(name)
+	if id != 0 {
+		t.mentions = append(t.mentions, frames.Mention{ObjectID: id, Start: start, End: t.Len()})
+	}
+	return t
+}
+
+func (t *eventText) initiator(initiator *common.Initiator) *eventText {
+	if airbase := initiator.GetAirbase(); airbase != nil {
+		return t.airbase(airbase)
+	}
+	return t.name(uint64(initiatorID(initiator)), describeInitiator(initiator))
+}
+
+func (t *eventText) target(target *common.Target) *eventText {
+	if airbase := target.GetAirbase(); airbase != nil {
+		return t.airbase(airbase)
+	}
+	return t.name(uint64(targetID(target)), describeTarget(target))
+}
+
+func (t *eventText) airbase(airbase *common.Airbase) *eventText {
+	return t.name(airbaseObjectID(airbase), describeAirbase(airbase))
+}
+
+// weapon appends the name of the weapon used in a hit or kill, if it is known.
+func (t *eventText) weapon(weapon *common.Weapon, weaponName *string) *eventText {
+	name := describeWeapon(weapon, weaponName)
+	if name == "" {
+		return t
+	}
+	return t.write(" with ").name(uint64(weapon.GetId()), name)
+}
+
+func initiatorID(initiator *common.Initiator) uint32 {
+	if _unit := initiator.GetUnit(); _unit != nil {
+		return _unit.GetId()
+	}
+	if weapon := initiator.GetWeapon(); weapon != nil {
+		return weapon.GetId()
+	}
+	if static := initiator.GetStatic(); static != nil {
+		return static.GetId()
+	}
+	return 0
+}
+
+func targetID(target *common.Target) uint32 {
+	if _unit := target.GetUnit(); _unit != nil {
+		return _unit.GetId()
+	}
+	if weapon := target.GetWeapon(); weapon != nil {
+		return weapon.GetId()
+	}
+	if static := target.GetStatic(); static != nil {
+		return static.GetId()
+	}
+	return 0
+}
+
+func describeInitiator(initiator *common.Initiator) string {
+	if _unit := initiator.GetUnit(); _unit != nil {
+		return describeUnit(_unit)
+	}
+	if weapon := initiator.GetWeapon(); weapon != nil {
+		return weapon.GetType()
+	}
+	if static := initiator.GetStatic(); static != nil {
+		return static.GetName()
+	}
+	if airbase := initiator.GetAirbase(); airbase != nil {
+		return describeAirbase(airbase)
+	}
+	if scenery := initiator.GetScenery(); scenery != nil {
+		return scenery.GetType()
+	}
+	return "unknown"
+}
+
+func describeTarget(target *common.Target) string {
+	if _unit := target.GetUnit(); _unit != nil {
+		return describeUnit(_unit)
+	}
+	if weapon := target.GetWeapon(); weapon != nil {
+		return weapon.GetType()
+	}
+	if static := target.GetStatic(); static != nil {
+		return static.GetName()
+	}
+	if airbase := target.GetAirbase(); airbase != nil {
+		return describeAirbase(airbase)
+	}
+	if scenery := target.GetScenery(); scenery != nil {
+		return scenery.GetType()
+	}
+	return "unknown"
+}
+
+func describeUnit(_unit *common.Unit) string {
+	name := _unit.GetName()
+	if _unit.PlayerName != nil && *_unit.PlayerName != "" {
+		name = *_unit.PlayerName
+	}
+	if _unit.GetType() == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, _unit.GetType())
+}
+
+func describeAirbase(airbase *common.Airbase) string {
+	if airbase.GetDisplayName() != "" {
+		return airbase.GetDisplayName()
+	}
+	return airbase.GetName()
+}
+
+func describeWeapon(weapon *common.Weapon, weaponName *string) string {
+	if weapon != nil && weapon.GetType() != "" {
+		return weapon.GetType()
+	}
+	if weaponName != nil {
+		return *weaponName
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/dharmab/goacmi/properties/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEventPayloads(t *testing.T) {
+	t.Parallel()
+	player := "Hunter"
+	viper := &common.Unit{Id: 0x1a, Name: "Enfield 1-1", Type: "F-16C_50", PlayerName: &player, Coalition: common.Coalition_COALITION_BLUE}
+	flanker := &common.Unit{Id: 0x2b, Name: "Ivan 1-1", Type: "Su-27", Coalition: common.Coalition_COALITION_RED}
+	missile := &common.Weapon{Id: 0x3c, Type: "AIM-120C", Position: &common.Position{Lat: 42, Lon: 41}}
+	kutaisi := &common.Airbase{Name: "Kutaisi", Category: common.AirbaseCategory_AIRBASE_CATEGORY_AIRDROME}
+	fromViper := &common.Initiator{Initiator: &common.Initiator_Unit{Unit: viper}}
+	fromFlanker := &common.Initiator{Initiator: &common.Initiator_Unit{Unit: flanker}}
+	atFlanker := &common.Target{Target: &common.Target_Unit{Unit: flanker}}
+	cannon := "M61A1"
+
+	testCases := []struct {
+		name     string
+		response *mission.StreamEventsResponse
+		// event is the expected event, or nil if the response produces no event.
+		event *frames.Event
+	}{
+		{
+			name: "hit",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Hit{Hit: &mission.StreamEventsResponse_HitEvent{
+				Initiator: fromViper, Target: atFlanker, WeaponName: &cannon,
+			}}},
+			event: &frames.Event{
+				Type:      events.Message,
+				ObjectIDs: []uint64{0x1a, 0x2b},
+				Text:      "Hunter (F-16C_50) hit Ivan 1-1 (Su-27) with M61A1",
+				Mentions:  []frames.Mention{{ObjectID: 0x1a, Start: 0, End: 17}, {ObjectID: 0x2b, Start: 22, End: 38}},
+			},
+		},
+		{
+			name: "kill",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Kill{Kill: &mission.StreamEventsResponse_KillEvent{
+				Initiator: fromViper, Target: atFlanker, Weapon: missile,
+			}}},
+			event: &frames.Event{
+				Type:      events.Destroyed,
+				ObjectIDs: []uint64{0x2b, 0x1a},
+				Text:      "Hunter (F-16C_50) destroyed Ivan 1-1 (Su-27) with AIM-120C",
+				Mentions: []frames.Mention{
+					{ObjectID: 0x1a, Start: 0, End: 17},
+					{ObjectID: 0x2b, Start: 28, End: 44},
+					{ObjectID: 0x3c, Start: 50, End: 58},
+				},
+			},
+		},
+		{
+			name: "takeoff",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Takeoff{Takeoff: &mission.StreamEventsResponse_TakeoffEvent{
+				Initiator: fromViper, Place: kutaisi,
+			}}},
+			event: &frames.Event{
+				Type:      events.TakenOff,
+				ObjectIDs: []uint64{0x1a},
+				Text:      "Hunter (F-16C_50) has taken off from Kutaisi",
+				Mentions:  []frames.Mention{{ObjectID: 0x1a, Start: 0, End: 17}, {ObjectID: airbaseID("Kutaisi"), Start: 37, End: 44}},
+			},
+		},
+		{
+			name: "landing",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Land{Land: &mission.StreamEventsResponse_LandEvent{
+				Initiator: fromViper, Place: kutaisi,
+			}}},
+			event: &frames.Event{
+				Type:      events.LandedEvent,
+				ObjectIDs: []uint64{0x1a},
+				Text:      "Hunter (F-16C_50) has landed at Kutaisi",
+				Mentions:  []frames.Mention{{ObjectID: 0x1a, Start: 0, End: 17}, {ObjectID: airbaseID("Kutaisi"), Start: 32, End: 39}},
+			},
+		},
+		{
+			name: "crash",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Crash{Crash: &mission.StreamEventsResponse_CrashEvent{
+				Initiator: fromFlanker,
+			}}},
+			event: &frames.Event{
+				Type:      events.Destroyed,
+				ObjectIDs: []uint64{0x2b},
+				Text:      "Ivan 1-1 (Su-27) has crashed",
+				Mentions:  []frames.Mention{{ObjectID: 0x2b, Start: 0, End: 16}},
+			},
+		},
+		{
+			name: "ejection",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Ejection{Ejection: &mission.StreamEventsResponse_EjectionEvent{
+				Initiator: fromFlanker,
+			}}},
+			event: &frames.Event{
+				Type:      events.Message,
+				ObjectIDs: []uint64{0x2b},
+				Text:      "Ivan 1-1 (Su-27) has ejected",
+				Mentions:  []frames.Mention{{ObjectID: 0x2b, Start: 0, End: 16}},
+			},
+		},
+		{
+			name: "pilot dead",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_PilotDead{PilotDead: &mission.StreamEventsResponse_PilotDeadEvent{
+				Initiator: fromFlanker,
+			}}},
+			event: &frames.Event{
+				Type:      events.Message,
+				ObjectIDs: []uint64{0x2b},
+				Text:      "The pilot of Ivan 1-1 (Su-27) has died",
+				Mentions:  []frames.Mention{{ObjectID: 0x2b, Start: 13, End: 29}},
+			},
+		},
+		{
+			name: "birth",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Birth{Birth: &mission.StreamEventsResponse_BirthEvent{
+				Initiator: fromViper, Place: kutaisi,
+			}}},
+			event: &frames.Event{
+				Type:      events.Message,
+				ObjectIDs: []uint64{0x1a},
+				Text:      "Hunter (F-16C_50) has spawned at Kutaisi",
+				Mentions:  []frames.Mention{{ObjectID: 0x1a, Start: 0, End: 17}, {ObjectID: airbaseID("Kutaisi"), Start: 33, End: 40}},
+			},
+		},
+		{
+			name: "unknown initiator",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Crash{Crash: &mission.StreamEventsResponse_CrashEvent{
+				Initiator: &common.Initiator{},
+			}}},
+			event: &frames.Event{Type: events.Destroyed, Text: "unknown has crashed"},
+		},
+		{
+			name: "unsupported",
+			response: &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_EngineStartup{EngineStartup: &mission.StreamEventsResponse_EngineStartupEvent{
+				Initiator: fromViper,
+			}}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			s := &Streamer{weapons: make(map[uint32]*trackedWeapon)}
+			payloads := s.buildEventPayloads(test.response)
+			if test.event == nil {
+				assert.Empty(t, payloads)
+				return
+			}
+			require.Len(t, payloads, 1)
+			assert.Nil(t, payloads[0].Update)
+			assert.Equal(t, test.event, payloads[0].Event)
+		})
+	}
+}
+
+func TestBuildEventPayloadsTracksShotWeapon(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{weapons: make(map[uint32]*trackedWeapon), precision: DefaultPrecision, coalitions: DefaultCoalitionMapping}
+	viper := &common.Unit{Id: 0x1a, Name: "Enfield 1-1", Type: "F-16C_50", Coalition: common.Coalition_COALITION_BLUE}
+	missile := &common.Weapon{Id: 0x3c, Type: "AIM-120C", Position: &common.Position{Lat: 42, Lon: 41}}
+
+	payloads := s.buildEventPayloads(&mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Shot{Shot: &mission.StreamEventsResponse_ShotEvent{
+		Initiator: &common.Initiator{Initiator: &common.Initiator_Unit{Unit: viper}},
+		Weapon:    missile,
+	}}})
+	require.Len(t, payloads, 1)
+	update := payloads[0].Update
+	require.NotNil(t, update)
+	assert.Equal(t, uint64(0x3c), update.ID)
+	assert.Equal(t, "Weapon", update.Properties[properties.Type])
+	assert.Equal(t, "AIM-120C", update.Properties[properties.Name])
+	assert.Equal(t, "1a", update.Properties[properties.Parent])
+	assert.Equal(t, "Blue", update.Properties[properties.Color])
+
+	// The weapon is removed when it hits, and the hit is announced.
+	payloads = s.buildEventPayloads(&mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Hit{Hit: &mission.StreamEventsResponse_HitEvent{
+		Initiator: &common.Initiator{Initiator: &common.Initiator_Unit{Unit: viper}},
+		Weapon:    missile,
+		Target:    &common.Target{},
+	}}})
+	require.Len(t, payloads, 2)
+	assert.True(t, payloads[0].Update.IsRemoval)
+	assert.Equal(t, uint64(0x3c), payloads[0].Update.ID)
+	assert.Equal(t, "Enfield 1-1 (F-16C_50) hit unknown with AIM-120C", payloads[1].Event.Text)
+	assert.Equal(t, []uint64{0x1a}, payloads[1].Event.ObjectIDs)
+}
@@ -0,0 +1,38 @@
+package streamer
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// missionNameInterval is how often to check whether the mission name has changed.
+const missionNameInterval = 10 * time.Second
+
+// watchMissionName periodically reads the mission name and sends a payload with MissionChanged set when it changes.
+func (s *Streamer) watchMissionName(ctx context.Context, updates chan<- Payload) {
+	ticker := time.NewTicker(missionNameInterval)
+	defer ticker.Stop()
+	var previous string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			name, err := s.GetMissionName(ctx)
+			if err != nil {
+				log.Warn().Err(err).Msg("failed to read mission name")
+				continue
+			}
+			if previous != "" && name != previous {
+				log.Info().Str("previous", previous).Str("current", name).Msg("mission name changed")
+				s.resetWeapons()
+				s.resetUnits()
+				s.resolveReference(ctx)
+				send(ctx, updates, Payload{MissionChanged: true})
+			}
+			previous = name
+		}
+	}
+}
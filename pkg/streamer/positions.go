@@ -0,0 +1,172 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/rs/zerolog/log"
+)
+
+// unitPositionsResult is the result of unitPositionsLua.
+type unitPositionsResult struct {
+	Time  float64         `json:"time"`
+	Units json.RawMessage `json:"units"`
+}
+
+// unitPositionsLua is evaluated in the mission scripting environment to read the positions of every unit in a group
+// category. The %d verb is replaced with the category as defined by Group.Category in the DCS scripting engine. Units
+// are keyed by their ID, which DCS-gRPC also uses.
+const unitPositionsLua = positionLua + `
+local category = %d
+local units = {}
+for _, side in pairs({ coalition.side.NEUTRAL, coalition.side.RED, coalition.side.BLUE }) do
+	for _, group in pairs(coalition.getGroups(side, category)) do
+		for _, unit in pairs(group:getUnits()) do
+			if unit:isExist() then
+				units[tostring(unit:getID())] = describePosition(unit)
+			end
+		end
+	end
+end
+return { time = timer.getTime(), units = units }
+`
+
+// scriptingGroupCategory converts a DCS-gRPC group category to the equivalent Group.Category in the DCS scripting
+// engine. Returns false if there is no equivalent.
+func scriptingGroupCategory(category common.GroupCategory) (int, bool) {
+	switch category {
+	case common.GroupCategory_GROUP_CATEGORY_AIRPLANE:
+		return 0, true
+	case common.GroupCategory_GROUP_CATEGORY_HELICOPTER:
+		return 1, true
+	case common.GroupCategory_GROUP_CATEGORY_GROUND:
+		return 2, true
+	case common.GroupCategory_GROUP_CATEGORY_SHIP:
+		return 3, true
+	case common.GroupCategory_GROUP_CATEGORY_TRAIN:
+		return 4, true
+	}
+	return 0, false
+}
+
+// pollUnitPositions reads the positions of units in the given category at the given interval, and sends an update
+// for each unit which has been announced by a unit stream.
+func (s *Streamer) pollUnitPositions(ctx context.Context, category common.GroupCategory, updates chan<- Payload, interval time.Duration) {
+	scriptingCategory, ok := scriptingGroupCategory(category)
+	if !ok {
+		return
+	}
+	logger := log.With().Stringer("category", category).Logger()
+	logger.Info().Stringer("interval", interval).Msg("polling unit positions")
+	lua := fmt.Sprintf(unitPositionsLua, scriptingCategory)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reference := s.currentReference()
+			payloads, err := s.pollPositions(ctx, lua)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to poll unit positions")
+				continue
+			}
+			for _, payload := range payloads {
+				payload.reference = reference
+				payload, ok := s.filterUnit(payload)
+				if !ok {
+					continue
+				}
+				if !send(ctx, updates, payload) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pollPositions evaluates unitPositionsLua and returns an update for each tracked unit in the result.
+func (s *Streamer) pollPositions(ctx context.Context, lua string) ([]Payload, error) {
+	resp, err := s.customServiceClient.Eval(ctx, &custom.EvalRequest{Lua: lua})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate unit positions script: %w", err)
+	}
+	var result unitPositionsResult
+	if err := json.Unmarshal([]byte(resp.GetJson()), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode unit positions script result: %w", err)
+	}
+	positions := make(map[string]objectPosition)
+	// An empty Lua table may be encoded as either an empty JSON object or an empty JSON array.
+	if raw := bytes.TrimSpace(result.Units); len(raw) > 0 && !bytes.Equal(raw, []byte("[]")) {
+		if err := json.Unmarshal(raw, &positions); err != nil {
+			return nil, fmt.Errorf("failed to decode unit positions: %w", err)
+		}
+	}
+
+	missionTime := toMissionTime(result.Time)
+	payloads := make([]Payload, 0, len(positions))
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	for key, position := range positions {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		// Units which have not been announced are skipped, so that objects are never created without their
+		// properties.
+		if _, ok := s.units[uint32(id)]; !ok {
+			continue
+		}
+		payloads = append(payloads, Payload{
+			Update: &objects.Update{
+				ID:         id,
+				Properties: map[string]string{properties.Transform: s.transform(position.coordinates())},
+			},
+			MissionTime: missionTime,
+		})
+	}
+	return payloads, nil
+}
+
+// trackUnit records that a unit has been announced by a unit stream.
+func (s *Streamer) trackUnit(id uint32) {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	s.units[id] = struct{}{}
+}
+
+// untrackUnit records that a unit has been removed.
+func (s *Streamer) untrackUnit(id uint32) {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	delete(s.units, id)
+	delete(s.countries, id)
+	delete(s.pendingCountries, id)
+}
+
+// resetUnits forgets every announced unit and static object, along with its country, its schedule and the transforms
+// sent for dead reckoning. It is used when the mission changes.
+func (s *Streamer) resetUnits() {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	s.units = make(map[uint32]struct{})
+	s.carriers = nil
+	s.statics = nil
+	s.countries = make(map[uint32]string)
+	s.pendingCountries = make(map[uint32]string)
+	if s.deadReckoner != nil {
+		s.deadReckoner.reset()
+	}
+	if s.scheduler != nil {
+		s.scheduler.reset()
+	}
+}
@@ -0,0 +1,128 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
+	"github.com/dharmab/goacmi/properties"
+	measure "github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// queuedEvalClient returns each result from Eval in turn, waiting for the next one to be queued.
+type queuedEvalClient struct {
+	custom.CustomServiceClient
+	results chan string
+}
+
+func (c *queuedEvalClient) Eval(ctx context.Context, _ *custom.EvalRequest, _ ...grpc.CallOption) (*custom.EvalResponse, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-c.results:
+		return &custom.EvalResponse{Json: result}, nil
+	}
+}
+
+// newPositionStreamer creates a streamer which has announced the given units.
+func newPositionStreamer(client custom.CustomServiceClient, ids ...uint32) *Streamer {
+	s := &Streamer{
+		customServiceClient: client,
+		units:               make(map[uint32]struct{}),
+		precision:           DefaultPrecision,
+		coalitions:          DefaultCoalitionMapping,
+		reference:           reference{longitude: 41, latitude: 43, set: true},
+	}
+	for _, id := range ids {
+		s.trackUnit(id)
+	}
+	return s
+}
+
+func TestPollPositions(t *testing.T) {
+	t.Parallel()
+	client := &evalClient{}
+	s := newPositionStreamer(client, 0x10, 0x11)
+
+	// Unit 18 has not been announced by a unit stream, and "x" is not a unit ID.
+	client.result = `{"time": 10, "units": {
+		"16": {"lat": 43.5, "lon": 41.25, "alt": 5100, "u": 1, "v": 2, "heading": 92, "yaw": 90, "pitch": 5, "roll": -10},
+		"17": {"lat": 43.5, "lon": 41.5, "alt": 0, "u": 3, "v": 4, "heading": 0, "yaw": 0, "pitch": 0, "roll": 0},
+		"18": {"lat": 43.5, "lon": 41.5, "alt": 0, "u": 3, "v": 4, "heading": 0, "yaw": 0, "pitch": 0, "roll": 0},
+		"x": {"lat": 43.5, "lon": 41.5, "alt": 0, "u": 3, "v": 4, "heading": 0, "yaw": 0, "pitch": 0, "roll": 0}
+	}}`
+	payloads, err := s.pollPositions(context.Background(), "")
+	require.NoError(t, err)
+	transforms := make(map[uint64]string)
+	for _, payload := range payloads {
+		assert.Equal(t, 10*time.Second, payload.MissionTime)
+		transforms[payload.Update.ID] = payload.Update.Properties[properties.Transform]
+	}
+	assert.Equal(t, map[uint64]string{
+		0x10: "0.25|0.5|5100|-10|5|90|1|2|92",
+		0x11: "0.5|0.5|0|0|0|0|3|4|0",
+	}, transforms)
+
+	// A unit which has been removed is no longer updated.
+	s.untrackUnit(0x11)
+	payloads, err = s.pollPositions(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	assert.Equal(t, uint64(0x10), payloads[0].Update.ID)
+}
+
+func TestPollPositionsWithoutUnits(t *testing.T) {
+	t.Parallel()
+	client := &evalClient{}
+	s := newPositionStreamer(client, 0x10)
+
+	// An empty Lua table may be encoded as either an empty JSON object or an empty JSON array.
+	for _, result := range []string{`{"time": 10, "units": {}}`, `{"time": 10, "units": []}`, `{"time": 10}`} {
+		client.result = result
+		payloads, err := s.pollPositions(context.Background(), "")
+		require.NoError(t, err, result)
+		assert.Empty(t, payloads, result)
+	}
+
+	client.result = `{"time": 10, "units": "none"}`
+	_, err := s.pollPositions(context.Background(), "")
+	assert.Error(t, err)
+	client.result = `nil`
+	_, err = s.pollPositions(context.Background(), "")
+	assert.Error(t, err)
+}
+
+func TestPollUnitPositions(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &queuedEvalClient{results: make(chan string)}
+	s := newPositionStreamer(client, 0x10)
+	s.EnableDeadReckoning(DeadReckoning{
+		PositionThreshold: 5 * measure.Meter,
+		AltitudeThreshold: 5 * measure.Meter,
+		AttitudeThreshold: 2 * measure.Degree,
+		MaxSilence:        time.Minute,
+	})
+
+	updates := make(chan Payload)
+	go s.pollUnitPositions(ctx, common.GroupCategory_GROUP_CATEGORY_AIRPLANE, updates, time.Millisecond)
+
+	client.results <- `{"time": 10, "units": {"16": {"lat": 43.5, "lon": 41.5, "alt": 5000, "u": 0, "v": 0, "heading": 90, "yaw": 90, "pitch": 0, "roll": 0}}}`
+	payload := <-updates
+	assert.Equal(t, uint64(0x10), payload.Update.ID)
+	assert.Equal(t, s.currentReference(), payload.reference)
+	assert.Equal(t, 10*time.Second, payload.MissionTime)
+
+	// The unit has not moved, so its transform is suppressed by dead reckoning and nothing is sent.
+	client.results <- `{"time": 11, "units": {"16": {"lat": 43.5, "lon": 41.5, "alt": 5000, "u": 0, "v": 0, "heading": 90, "yaw": 90, "pitch": 0, "roll": 0}}}`
+	client.results <- `{"time": 12, "units": {"16": {"lat": 43.5, "lon": 41.5, "alt": 5000, "u": 500, "v": 0, "heading": 90, "yaw": 90, "pitch": 0, "roll": 0}}}`
+	payload = <-updates
+	assert.Equal(t, 12*time.Second, payload.MissionTime)
+	assert.Equal(t, "0.5|0.5|5000|0|0|90|500|0|90", payload.Update.Properties[properties.Transform])
+}
@@ -0,0 +1,248 @@
+package streamer
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dharmab/goacmi/properties"
+	"github.com/dharmab/goacmi/tags"
+	measure "github.com/martinlindhe/unit"
+)
+
+// AdaptiveRates configures per-unit update rates. Units which are turning, accelerating or near another aircraft are
+// updated as often as they are polled, and other units are updated at SlowInterval. If the units would need more than
+// Budget updates per second, every unit's interval is lengthened in proportion. A unit is never updated more often than
+// it is polled.
+type AdaptiveRates struct {
+	// TurnRateThreshold is the rate of turn per second above which a unit is updated at the full rate.
+	TurnRateThreshold measure.Angle
+	// AccelerationThreshold is the change of speed per second above which a unit is updated at the full rate.
+	AccelerationThreshold measure.Acceleration
+	// ProximityThreshold is the distance from another aircraft within which an aircraft is updated at the full rate.
+	ProximityThreshold measure.Length
+	// SlowInterval is how often other units are updated.
+	SlowInterval time.Duration
+	// Budget is the maximum number of unit updates per second, or zero for no limit.
+	Budget float64
+}
+
+// EnableAdaptiveRates schedules unit updates as configured. It must be called before Stream.
+func (s *Streamer) EnableAdaptiveRates(config AdaptiveRates) {
+	s.scheduler = &scheduler{config: config, units: make(map[uint64]*scheduledUnit)}
+}
+
+// schedule removes a unit's transform from a payload's update if the unit is not due for an update. Returns false if
+// nothing remains to be sent.
+func (s *Streamer) schedule(payload Payload) (Payload, bool) {
+	if s.scheduler == nil {
+		return payload, true
+	}
+	return s.scheduler.filter(payload)
+}
+
+// filterUnit schedules and then suppresses a unit's transform. Returns false if nothing remains to be sent.
+func (s *Streamer) filterUnit(payload Payload) (Payload, bool) {
+	payload, ok := s.schedule(payload)
+	if !ok {
+		return payload, false
+	}
+	return s.suppress(payload)
+}
+
+// scheduledUnit is the motion of a unit, measured from its two most recent reports.
+type scheduledUnit struct {
+	// observed is the most recent report of the unit, whether or not it was sent.
+	observed report
+	// speed is in meters per second. measured is true once speed has been measured.
+	speed    float64
+	measured bool
+	// pollInterval is the mission time between the two most recent reports.
+	pollInterval time.Duration
+	// air is true if the unit is an aircraft.
+	air bool
+	// interval is how often the unit should be updated, before the budget is applied.
+	interval time.Duration
+	// sent is the mission time of the last transform sent for the unit.
+	sent time.Duration
+}
+
+// gridCell is a cube of the proximity grid, indexed by position divided by the proximity threshold.
+type gridCell [3]int64
+
+// gridEntry is an aircraft in the proximity grid.
+type gridEntry struct {
+	id             uint64
+	u, v, altitude float64
+}
+
+// scheduler chooses how often each unit is updated.
+type scheduler struct {
+	config AdaptiveRates
+	lock   sync.Mutex
+	units  map[uint64]*scheduledUnit
+	// cycle is the mission time of the newest report. The total rate and the proximity grid are measured once for
+	// each mission time, so that scheduling a unit does not require visiting every other unit.
+	cycle time.Duration
+	// rate is the number of updates per second the units needed at the start of the cycle.
+	rate float64
+	// grid holds the aircraft at the start of the cycle, by the cell containing their position.
+	grid map[gridCell][]gridEntry
+}
+
+func (c *scheduler) filter(payload Payload) (Payload, bool) {
+	update := payload.Update
+	if update == nil {
+		return payload, true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if update.IsRemoval {
+		delete(c.units, update.ID)
+		return payload, true
+	}
+	observed, ok := parseReport(payload.MissionTime, update.Properties[properties.Transform])
+	if !ok {
+		return payload, true
+	}
+	if observed.time > c.cycle {
+		c.measure(observed.time)
+	}
+
+	unit, known := c.units[update.ID]
+	if !known {
+		unit = &scheduledUnit{observed: observed, sent: observed.time}
+		c.units[update.ID] = unit
+	}
+	if unitType, ok := update.Properties[properties.Type]; ok {
+		unit.air = slices.Contains(strings.Split(unitType, "+"), tags.Air)
+	}
+	if !known {
+		return payload, true
+	}
+	// Reports which are no newer than the last report, such as those from a slower stream, do not affect the
+	// measured motion.
+	if observed.time > unit.observed.time {
+		c.observe(update.ID, unit, observed)
+	}
+	if observed.time-unit.sent < c.scaledInterval(unit) {
+		return withoutTransform(payload)
+	}
+	unit.sent = observed.time
+	return payload, true
+}
+
+// observe measures a unit's motion from a new report and chooses its interval.
+func (c *scheduler) observe(id uint64, unit *scheduledUnit, observed report) {
+	previous := unit.observed
+	unit.observed = observed
+	unit.pollInterval = observed.time - previous.time
+	elapsed := unit.pollInterval.Seconds()
+
+	speed := math.Sqrt(
+		math.Pow(observed.u-previous.u, 2)+
+			math.Pow(observed.v-previous.v, 2)+
+			math.Pow(observed.altitude-previous.altitude, 2),
+	) / elapsed
+	acceleration := 0.0
+	if unit.measured {
+		acceleration = math.Abs(speed-unit.speed) / elapsed
+	}
+	unit.speed = speed
+	unit.measured = true
+	turnRate := math.Abs(angleDifference(observed.heading, previous.heading)) / elapsed
+
+	active := turnRate > c.config.TurnRateThreshold.Degrees() ||
+		acceleration > c.config.AccelerationThreshold.MetersPerSecondSquared() ||
+		c.nearAircraft(id, unit)
+	if active {
+		unit.interval = unit.pollInterval
+	} else {
+		unit.interval = max(c.config.SlowInterval, unit.pollInterval)
+	}
+}
+
+// measure starts a new cycle at the given mission time. It sums the rates of all units and places every aircraft in the
+// proximity grid.
+func (c *scheduler) measure(missionTime time.Duration) {
+	c.cycle = missionTime
+	c.rate = 0
+	c.grid = make(map[gridCell][]gridEntry)
+	threshold := c.config.ProximityThreshold.Meters()
+	for id, unit := range c.units {
+		if unit.interval > 0 {
+			c.rate += 1 / unit.interval.Seconds()
+		}
+		if unit.air && threshold > 0 {
+			cell := c.cell(unit.observed)
+			c.grid[cell] = append(c.grid[cell], gridEntry{
+				id:       id,
+				u:        unit.observed.u,
+				v:        unit.observed.v,
+				altitude: unit.observed.altitude,
+			})
+		}
+	}
+}
+
+// cell returns the grid cell containing a report's position.
+func (c *scheduler) cell(r report) gridCell {
+	threshold := c.config.ProximityThreshold.Meters()
+	return gridCell{
+		int64(math.Floor(r.u / threshold)),
+		int64(math.Floor(r.v / threshold)),
+		int64(math.Floor(r.altitude / threshold)),
+	}
+}
+
+// nearAircraft returns true if the unit is an aircraft within the proximity threshold of another aircraft, as placed
+// in the grid at the start of the cycle. Only the unit's cell and its neighbours are searched, since the cells are as
+// wide as the threshold.
+func (c *scheduler) nearAircraft(id uint64, unit *scheduledUnit) bool {
+	threshold := c.config.ProximityThreshold.Meters()
+	if !unit.air || threshold <= 0 {
+		return false
+	}
+	center := c.cell(unit.observed)
+	for du := int64(-1); du <= 1; du++ {
+		for dv := int64(-1); dv <= 1; dv++ {
+			for da := int64(-1); da <= 1; da++ {
+				for _, other := range c.grid[gridCell{center[0] + du, center[1] + dv, center[2] + da}] {
+					if other.id == id {
+						continue
+					}
+					distance := math.Sqrt(
+						math.Pow(unit.observed.u-other.u, 2) +
+							math.Pow(unit.observed.v-other.v, 2) +
+							math.Pow(unit.observed.altitude-other.altitude, 2),
+					)
+					if distance < threshold {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// scaledInterval returns the unit's interval, lengthened if the intervals of all units at the start of the cycle
+// would exceed the budget.
+func (c *scheduler) scaledInterval(unit *scheduledUnit) time.Duration {
+	if c.config.Budget <= 0 || c.rate <= c.config.Budget {
+		return unit.interval
+	}
+	return time.Duration(float64(unit.interval) * c.rate / c.config.Budget)
+}
+
+// reset forgets every unit. It is used when the mission changes.
+func (c *scheduler) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.units = make(map[uint64]*scheduledUnit)
+	c.cycle = 0
+	c.rate = 0
+	c.grid = nil
+}
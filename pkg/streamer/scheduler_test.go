@@ -0,0 +1,111 @@
+package streamer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	measure "github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerSlowsCruisingUnits(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{}
+	s.EnableAdaptiveRates(AdaptiveRates{
+		TurnRateThreshold:     3 * measure.Degree,
+		AccelerationThreshold: 5 * measure.MeterPerSecondSquared,
+		ProximityThreshold:    1000 * measure.Meter,
+		SlowInterval:          2 * time.Second,
+	})
+	sent := func(id uint64, missionTime time.Duration, u, heading float64) bool {
+		payload, ok := s.schedule(Payload{
+			Update: &objects.Update{ID: id, Properties: map[string]string{
+				properties.Transform: fmt.Sprintf("1|2|1000|0|0|0|%f|0|%f", u, heading),
+				properties.Type:      "Air+FixedWing",
+			}},
+			MissionTime: missionTime,
+		})
+		require.True(t, ok)
+		_, ok = payload.Update.Properties[properties.Transform]
+		return ok
+	}
+
+	// A tanker cruising in a straight line is updated every two seconds.
+	assert.True(t, sent(0x1, 0, 0, 90))
+	assert.False(t, sent(0x1, 1*time.Second, 200, 90))
+	assert.True(t, sent(0x1, 2*time.Second, 400, 90))
+	assert.False(t, sent(0x1, 3*time.Second, 600, 90))
+
+	// Once it turns, it is updated every time it is polled.
+	assert.True(t, sent(0x1, 4*time.Second, 800, 100))
+	assert.True(t, sent(0x1, 5*time.Second, 1000, 110))
+
+	// A fighter joins it, so it is updated at the full rate even after it stops turning.
+	assert.True(t, sent(0x2, 5*time.Second, 1500, 110))
+	assert.True(t, sent(0x1, 6*time.Second, 1200, 110))
+	assert.True(t, sent(0x1, 7*time.Second, 1400, 110))
+}
+
+func TestSchedulerBudget(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{}
+	s.EnableAdaptiveRates(AdaptiveRates{
+		TurnRateThreshold:     3 * measure.Degree,
+		AccelerationThreshold: 5 * measure.MeterPerSecondSquared,
+		SlowInterval:          time.Second,
+		Budget:                1,
+	})
+	count := 0
+	for tick := range 9 {
+		for id := range uint64(2) {
+			// Updates which carry only a transform are dropped entirely when the unit is not due.
+			_, ok := s.schedule(Payload{
+				Update:      &objects.Update{ID: id, Properties: map[string]string{properties.Transform: "1|2|0|0|0|0|0|0|0"}},
+				MissionTime: time.Duration(tick) * time.Second,
+			})
+			if ok {
+				count++
+			}
+		}
+	}
+	// Two parked units would be updated once per second each, but the budget allows one update per second in total.
+	assert.Equal(t, 10, count)
+}
+
+func TestSchedulerProximityAcrossCells(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{}
+	s.EnableAdaptiveRates(AdaptiveRates{
+		TurnRateThreshold:     3 * measure.Degree,
+		AccelerationThreshold: 5 * measure.MeterPerSecondSquared,
+		ProximityThreshold:    1000 * measure.Meter,
+		SlowInterval:          5 * time.Second,
+	})
+	sent := func(id uint64, missionTime time.Duration, u float64) bool {
+		payload, ok := s.schedule(Payload{
+			Update: &objects.Update{ID: id, Properties: map[string]string{
+				properties.Transform: fmt.Sprintf("1|2|1000|0|0|0|%f|0|90", u),
+				properties.Type:      "Air+FixedWing",
+			}},
+			MissionTime: missionTime,
+		})
+		require.True(t, ok)
+		_, ok = payload.Update.Properties[properties.Transform]
+		return ok
+	}
+
+	// Two aircraft 200 meters apart on either side of a cell boundary are near each other, while a third aircraft
+	// in a neighbouring cell but farther than the threshold is not.
+	assert.True(t, sent(0x1, 0, 900))
+	assert.True(t, sent(0x2, 0, 1100))
+	assert.True(t, sent(0x3, 0, 2500))
+	assert.True(t, sent(0x1, time.Second, 900))
+	assert.True(t, sent(0x2, time.Second, 1100))
+	assert.False(t, sent(0x3, time.Second, 2500))
+	assert.True(t, sent(0x1, 2*time.Second, 900))
+	assert.False(t, sent(0x3, 2*time.Second, 2500))
+}
@@ -0,0 +1,187 @@
+package streamer
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/coalition"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/world"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/dharmab/goacmi/properties/events"
+	"github.com/dharmab/goacmi/tags"
+	"github.com/rs/zerolog/log"
+)
+
+// airbaseIDBase is the lowest object ID given to airbases. DCS does not give airbases object IDs, so each airbase is
+// identified by a hash of its name above the range of DCS object IDs. The ID is the same in every recording of a
+// mission.
+const airbaseIDBase = 1 << 32
+
+// airbaseID returns the object ID of the airbase with the given name.
+func airbaseID(name string) uint64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return airbaseIDBase + uint64(h.Sum32())
+}
+
+// GetStaticObjects returns updates which create the static objects, airfields and FARPs in the mission. Carriers are
+// not included because the unit streams already export them as ships; they are tagged as aircraft carriers instead.
+// Objects whose countries cannot be read are created without a country.
+func (s *Streamer) GetStaticObjects(ctx context.Context) ([]*objects.Update, error) {
+	resp, err := s.worldServiceClient.GetAirbases(ctx, &world.GetAirbasesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]*objects.Update, 0)
+	airbaseNames := make(map[uint64]string)
+	staticNames := make(map[uint64]string)
+	// FARPs are both airbases and static objects. They are exported once, as airbases.
+	helipads := make(map[string]struct{})
+	carriers := make(map[uint32]struct{})
+	for _, airbase := range resp.GetAirbases() {
+		if _unit := airbase.GetUnit(); _unit != nil {
+			carriers[_unit.GetId()] = struct{}{}
+			continue
+		}
+		if airbase.GetCategory() == common.AirbaseCategory_AIRBASE_CATEGORY_HELIPAD {
+			helipads[airbase.GetName()] = struct{}{}
+		}
+		airbaseNames[airbaseID(airbase.GetName())] = airbase.GetName()
+		updates = append(updates, s.buildAirbase(airbase))
+	}
+	s.unitsLock.Lock()
+	s.carriers = carriers
+	s.unitsLock.Unlock()
+
+	statics := make(map[uint32]struct{})
+	for _, c := range []common.Coalition{common.Coalition_COALITION_BLUE, common.Coalition_COALITION_NEUTRAL, common.Coalition_COALITION_RED} {
+		resp, err := s.coalitionServiceClient.GetStaticObjects(ctx, &coalition.GetStaticObjectsRequest{Coalition: c})
+		if err != nil {
+			return nil, err
+		}
+		for _, static := range resp.GetStatics() {
+			if _, ok := helipads[static.GetName()]; ok {
+				continue
+			}
+			statics[static.GetId()] = struct{}{}
+			if static.GetName() != "" {
+				staticNames[uint64(static.GetId())] = static.GetName()
+			}
+			updates = append(updates, s.buildStatic(static))
+		}
+	}
+	s.unitsLock.Lock()
+	s.statics = statics
+	s.unitsLock.Unlock()
+
+	if len(airbaseNames)+len(staticNames) > 0 {
+		codes, err := s.staticCountries(ctx, staticNames, airbaseNames)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to read static object countries")
+		}
+		for _, update := range updates {
+			if code, ok := codes[update.ID]; ok {
+				update.Properties[properties.Country] = code
+			}
+		}
+	}
+	return updates, nil
+}
+
+func (s *Streamer) buildAirbase(airbase *common.Airbase) *objects.Update {
+	types := []string{tags.Ground, tags.Static, tags.Aerodrome}
+	if airbase.GetCategory() == common.AirbaseCategory_AIRBASE_CATEGORY_HELIPAD {
+		types = []string{"Navaid", tags.Static}
+	}
+	update := &objects.Update{
+		ID: airbaseID(airbase.GetName()),
+		Properties: map[string]string{
+			properties.Type:      strings.Join(types, "+"),
+			properties.Name:      frames.Escape(describeAirbase(airbase)),
+			properties.Transform: s.transform(buildCoordinates(airbase.GetPosition(), nil)),
+			properties.Coalition: s.convertCoalition(airbase.GetCoalition()),
+			properties.Color:     coalitionColor(airbase.GetCoalition()),
+		},
+	}
+	if airbase.GetCallsign() != "" {
+		update.Properties[properties.CallSign] = frames.Escape(airbase.GetCallsign())
+	}
+	return update
+}
+
+func (s *Streamer) buildStatic(static *common.Static) *objects.Update {
+	update := &objects.Update{
+		ID: uint64(static.GetId()),
+		Properties: map[string]string{
+			properties.Type:      strings.Join([]string{tags.Ground, tags.Static}, "+"),
+			properties.Transform: s.transform(buildCoordinates(static.GetPosition(), nil)),
+			properties.Coalition: s.convertCoalition(static.GetCoalition()),
+			properties.Color:     coalitionColor(static.GetCoalition()),
+		},
+	}
+	if static.GetType() != "" {
+		update.Properties[properties.Name] = frames.Escape(static.GetType())
+	}
+	if static.GetName() != "" {
+		update.Properties[properties.CallSign] = frames.Escape(static.GetName())
+	}
+	return update
+}
+
+// buildCapturePayloads returns an update which changes the coalition of a captured airbase, and an event which
+// announces the capture. Captured carriers produce no payloads.
+func (s *Streamer) buildCapturePayloads(capture *mission.StreamEventsResponse_BaseCaptureEvent) []Payload {
+	place := capture.GetPlace()
+	if place == nil || place.GetUnit() != nil {
+		return nil
+	}
+	id := airbaseID(place.GetName())
+	update := &objects.Update{
+		ID: id,
+		Properties: map[string]string{
+			properties.Coalition: s.convertCoalition(place.GetCoalition()),
+			properties.Color:     coalitionColor(place.GetCoalition()),
+		},
+	}
+	text := &eventText{}
+	if initiator := capture.GetInitiator(); initiator != nil {
+		text.initiator(initiator).write(" captured ").airbase(place)
+	} else {
+		text.airbase(place).write(" was captured")
+	}
+	event := &frames.Event{Type: events.Message, ObjectIDs: []uint64{id}, Text: text.String(), Mentions: text.mentions}
+	return []Payload{{Update: update}, {Event: event}}
+}
+
+// airbaseObjectID returns the object ID of an airbase. A carrier is the ship which carries it.
+func airbaseObjectID(airbase *common.Airbase) uint64 {
+	if _unit := airbase.GetUnit(); _unit != nil {
+		return uint64(_unit.GetId())
+	}
+	return airbaseID(airbase.GetName())
+}
+
+// isCarrier returns true if the unit is a ship which is also an airbase.
+func (s *Streamer) isCarrier(id uint32) bool {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	_, ok := s.carriers[id]
+	return ok
+}
+
+// untrackStatic forgets a destroyed static object and returns an update which removes it. Returns nil if the object is
+// not an exported static object.
+func (s *Streamer) untrackStatic(id uint32) *objects.Update {
+	s.unitsLock.Lock()
+	defer s.unitsLock.Unlock()
+	if _, ok := s.statics[id]; !ok {
+		return nil
+	}
+	delete(s.statics, id)
+	return &objects.Update{ID: uint64(id), IsRemoval: true}
+}
@@ -0,0 +1,78 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAirbaseCapture(t *testing.T) {
+	t.Parallel()
+	airbase := &common.Airbase{
+		Name:      "Kutaisi",
+		Coalition: common.Coalition_COALITION_RED,
+		Category:  common.AirbaseCategory_AIRBASE_CATEGORY_AIRDROME,
+		Position:  &common.Position{Lat: 42.17, Lon: 42.48, Alt: 45},
+	}
+	s := &Streamer{precision: DefaultPrecision, coalitions: DefaultCoalitionMapping}
+	initial := s.buildAirbase(airbase)
+	assert.Equal(t, "Ground+Static+Aerodrome", initial.Properties[properties.Type])
+	assert.Equal(t, "Kutaisi", initial.Properties[properties.Name])
+	assert.Equal(t, "Red", initial.Properties[properties.Color])
+	assert.Greater(t, initial.ID, uint64(airbaseIDBase))
+
+	airbase.Coalition = common.Coalition_COALITION_BLUE
+	payloads := s.buildCapturePayloads(&mission.StreamEventsResponse_BaseCaptureEvent{Place: airbase})
+	require.Len(t, payloads, 2)
+	assert.Equal(t, initial.ID, payloads[0].Update.ID)
+	assert.Equal(t, "Blue", payloads[0].Update.Properties[properties.Color])
+	assert.Equal(t, []uint64{initial.ID}, payloads[1].Event.ObjectIDs)
+	assert.Equal(t, "Kutaisi was captured", payloads[1].Event.Text)
+	assert.Equal(t, []frames.Mention{{ObjectID: initial.ID, Start: 0, End: 7}}, payloads[1].Event.Mentions)
+
+	carrier := &common.Airbase{Name: "CVN-73", Unit: &common.Unit{Id: 0x2a}}
+	assert.Empty(t, s.buildCapturePayloads(&mission.StreamEventsResponse_BaseCaptureEvent{Place: carrier}))
+}
+
+func TestStaticNamesAreEscaped(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{precision: DefaultPrecision, coalitions: DefaultCoalitionMapping}
+	airbase := s.buildAirbase(&common.Airbase{Name: "Batumi, Georgia", Callsign: "Tower,\nBatumi"})
+	assert.Equal(t, `Batumi\, Georgia`, airbase.Properties[properties.Name])
+	assert.Equal(t, "Tower\\,\\\nBatumi", airbase.Properties[properties.CallSign])
+
+	static := s.buildStatic(&common.Static{Id: 0x10, Name: "Depot, North", Type: "Warehouse"})
+	assert.Equal(t, "Warehouse", static.Properties[properties.Name])
+	assert.Equal(t, `Depot\, North`, static.Properties[properties.CallSign])
+	assert.Contains(t, static.String(), `CallSign=Depot\, North`)
+}
+
+func TestDestroyedStaticIsRemoved(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{statics: map[uint32]struct{}{0x10: {}, 0x11: {}}}
+	bunker := &common.Static{Id: 0x10, Name: "Bunker", Type: "Bunker"}
+	kill := &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Kill{Kill: &mission.StreamEventsResponse_KillEvent{
+		Target: &common.Target{Target: &common.Target_Static{Static: bunker}},
+	}}}
+	payloads := s.buildEventPayloads(kill)
+	require.Len(t, payloads, 2)
+	assert.NotNil(t, payloads[0].Event)
+	assert.Equal(t, &objects.Update{ID: 0x10, IsRemoval: true}, payloads[1].Update)
+
+	// A static object is only removed once, however many events report it destroyed.
+	dead := func(id uint32) *mission.StreamEventsResponse {
+		return &mission.StreamEventsResponse{Event: &mission.StreamEventsResponse_Dead{Dead: &mission.StreamEventsResponse_DeadEvent{
+			Initiator: &common.Initiator{Initiator: &common.Initiator_Static{Static: &common.Static{Id: id}}},
+		}}}
+	}
+	assert.Empty(t, s.buildEventPayloads(dead(0x10)))
+	payloads = s.buildEventPayloads(dead(0x11))
+	require.Len(t, payloads, 1)
+	assert.Equal(t, &objects.Update{ID: 0x11, IsRemoval: true}, payloads[0].Update)
+}
@@ -4,17 +4,20 @@ import (
 	"context"
 	"errors"
 	"io"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/coalition"
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/hook"
 	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/world"
+	"github.com/dharmab/acmi-exporter/pkg/frames"
 	"github.com/dharmab/goacmi/objects"
 	"github.com/dharmab/goacmi/properties"
-	"github.com/dharmab/goacmi/properties/coalitions"
 	"github.com/dharmab/goacmi/properties/colors"
 	"github.com/dharmab/goacmi/tags"
 	measure "github.com/martinlindhe/unit"
@@ -22,58 +25,170 @@ import (
 )
 
 type Payload struct {
-	Update      *objects.Update
+	Update *objects.Update
+	// Event is a notable event, such as a unit being destroyed. A payload carries either an update or an event.
+	Event       *frames.Event
 	MissionTime time.Duration
+	// MissionChanged indicates that the mission was started, stopped, restarted or replaced. The payload carries no
+	// update, and updates which follow it belong to a new recording.
+	MissionChanged bool
+	// reference is the generation of the reference point which the payload's transforms are relative to.
+	reference uint64
 }
 
 type Streamer struct {
 	missionServiceClient   mission.MissionServiceClient
 	coalitionServiceClient coalition.CoalitionServiceClient
 	hookServiceClient      hook.HookServiceClient
+	customServiceClient    custom.CustomServiceClient
+	worldServiceClient     world.WorldServiceClient
+
+	weapons     map[uint32]*trackedWeapon
+	weaponsLock sync.Mutex
+
+	// units holds the IDs of units which have been announced by a unit stream and not removed.
+	units map[uint32]struct{}
+	// carriers holds the IDs of ships which are also airbases.
+	carriers map[uint32]struct{}
+	// statics holds the IDs of static objects which have been exported and not destroyed.
+	statics map[uint32]struct{}
+	// countries maps unit IDs to their country codes, or to an empty string if their country has no code.
+	countries map[uint32]string
+	// pendingCountries maps the IDs of units whose countries have not been read to their names.
+	pendingCountries map[uint32]string
+	unitsLock        sync.Mutex
+
+	// coalitions maps DCS coalitions to ACMI coalitions.
+	coalitions CoalitionMapping
+	// precision is the number of decimal places in each component of a transform.
+	precision Precision
+	// reference is the point which transforms are written relative to.
+	reference reference
+	// referenceGeneration is incremented each time resolveReference replaces the reference point.
+	referenceGeneration uint64
+	referenceLock       sync.Mutex
+
+	// scheduler chooses how often each unit is updated. It is nil unless adaptive rates are enabled.
+	scheduler *scheduler
+	// deadReckoner suppresses predictable transforms. It is nil unless dead reckoning is enabled.
+	deadReckoner *deadReckoner
 }
 
 func New(
 	missionServiceClient mission.MissionServiceClient,
 	coalitionServiceClient coalition.CoalitionServiceClient,
 	hookServiceClient hook.HookServiceClient,
+	customServiceClient custom.CustomServiceClient,
+	worldServiceClient world.WorldServiceClient,
 ) *Streamer {
 	return &Streamer{
 		missionServiceClient:   missionServiceClient,
 		coalitionServiceClient: coalitionServiceClient,
 		hookServiceClient:      hookServiceClient,
+		customServiceClient:    customServiceClient,
+		worldServiceClient:     worldServiceClient,
+		weapons:                make(map[uint32]*trackedWeapon),
+		units:                  make(map[uint32]struct{}),
+		countries:              make(map[uint32]string),
+		pendingCountries:       make(map[uint32]string),
+		precision:              DefaultPrecision,
+		coalitions:             DefaultCoalitionMapping,
 	}
 }
 
 func (s *Streamer) Stream(ctx context.Context, updates chan<- Payload, airUpdateInterval, surfaceUpdateInterval, weaponUpdateInterval time.Duration) {
+	s.resolveReference(ctx)
+
 	var wg sync.WaitGroup
 	streamCtx, cancel := context.WithCancel(ctx)
+	queued := make(chan Payload)
 
-	wg.Add(5)
+	wg.Add(10)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		s.forward(streamCtx, queued, updates)
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_AIRPLANE, queued, airUpdateInterval)
+	}()
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_AIRPLANE, updates, airUpdateInterval)
+		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_HELICOPTER, queued, airUpdateInterval)
 	}()
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_HELICOPTER, updates, airUpdateInterval)
+		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_GROUND, queued, surfaceUpdateInterval)
 	}()
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_GROUND, updates, surfaceUpdateInterval)
+		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_SHIP, queued, surfaceUpdateInterval)
 	}()
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_SHIP, updates, surfaceUpdateInterval)
+		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_UNSPECIFIED, queued, surfaceUpdateInterval)
 	}()
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		s.streamUnits(streamCtx, common.GroupCategory_GROUP_CATEGORY_UNSPECIFIED, updates, surfaceUpdateInterval)
+		s.streamEvents(streamCtx, queued)
 	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		s.streamWeapons(streamCtx, queued, weaponUpdateInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		s.watchMissionName(streamCtx, queued)
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		s.streamCountries(streamCtx, queued)
+	}()
+	wg.Wait()
+}
+
+// forward sends queued payloads to the caller in order, discarding those built relative to a reference point which has
+// since been replaced. A payload forwarded before a mission change was checked before the reference point was replaced,
+// so it belongs to the recording which the change ends.
+func (s *Streamer) forward(ctx context.Context, queued <-chan Payload, updates chan<- Payload) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-queued:
+			if !payload.MissionChanged && payload.reference != s.currentReference() {
+				continue
+			}
+			if !send(ctx, updates, payload) {
+				return
+			}
+		}
+	}
+}
+
+// toMissionTime converts a mission time in seconds, as reported by DCS, to a duration. Fractions of a second are kept.
+func toMissionTime(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// send sends a payload unless the context is cancelled first. Returns false if the context was cancelled.
+func send(ctx context.Context, updates chan<- Payload, payload Payload) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case updates <- payload:
+		return true
+	}
 }
 
 func (s *Streamer) GetGlobalObject(ctx context.Context) (*objects.Object, error) {
@@ -98,8 +213,9 @@ func (s *Streamer) GetGlobalObject(ctx context.Context) (*objects.Object, error)
 
 	global.SetProperty(properties.DataRecorder, "acmi-exporter")
 	global.SetProperty(properties.DataSource, "DCS World")
-	global.SetProperty(properties.ReferenceLongitude, "0")
-	global.SetProperty(properties.ReferenceLatitude, "0")
+	longitude, latitude := s.referencePoint()
+	global.SetProperty(properties.ReferenceLongitude, strconv.FormatFloat(longitude, 'f', -1, 64))
+	global.SetProperty(properties.ReferenceLatitude, strconv.FormatFloat(latitude, 'f', -1, 64))
 
 	return global, nil
 }
@@ -134,7 +250,7 @@ const (
 	redBullseyeID     = 0x40000003
 )
 
-func (s Streamer) GetBullseyes(ctx context.Context) ([]*objects.Object, error) {
+func (s *Streamer) GetBullseyes(ctx context.Context) ([]*objects.Object, error) {
 	bullseyes := make([]*objects.Object, 0)
 	for _, c := range []common.Coalition{common.Coalition_COALITION_BLUE, common.Coalition_COALITION_NEUTRAL, common.Coalition_COALITION_RED} {
 		resp, err := s.coalitionServiceClient.GetBullseye(ctx, &coalition.GetBullseyeRequest{Coalition: c})
@@ -153,7 +269,7 @@ func (s *Streamer) buildBullseye(resp *coalition.GetBullseyeResponse, c common.C
 	bullseye := &objects.Object{
 		Properties: map[string]string{
 			properties.Type:      strings.Join([]string{"Navaid", tags.Static, tags.Bullseye}, "+"),
-			properties.Coalition: convertCoalition(c),
+			properties.Coalition: s.convertCoalition(c),
 			properties.Color:     coalitionColor(c),
 		},
 	}
@@ -165,7 +281,7 @@ func (s *Streamer) buildBullseye(resp *coalition.GetBullseyeResponse, c common.C
 			&position.U, &position.V,
 			nil, nil, nil, nil,
 		)
-		bullseye.Properties[properties.Transform] = coordinates.Transform(0, 0)
+		bullseye.Properties[properties.Transform] = s.transform(coordinates)
 	}
 	switch c {
 	case common.Coalition_COALITION_RED:
@@ -178,16 +294,27 @@ func (s *Streamer) buildBullseye(resp *coalition.GetBullseyeResponse, c common.C
 	return bullseye
 }
 
+// streamUnits streams units of the given category. DCS-gRPC polls units in whole seconds, so if the interval is less
+// than a second, the stream is polled every second to announce and remove units, and their positions are polled
+// separately at the interval.
 func (s *Streamer) streamUnits(ctx context.Context, category common.GroupCategory, updates chan<- Payload, interval time.Duration) {
-	pollRate := uint32(interval.Seconds())
+	pollRate := uint32(max(interval.Seconds(), 1))
+	if interval < time.Second {
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.pollUnitPositions(ctx, category, updates, interval)
+		}()
+	}
 	request := &mission.StreamUnitsRequest{PollRate: &pollRate, Category: category}
 	for {
 		nextAttempt := time.Now().Add(interval)
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			time.Sleep(time.Until(nextAttempt))
+		case <-time.After(time.Until(nextAttempt)):
 			logger := log.With().Stringer("category", category).Logger()
 			logger.Info().Msg("creating new unit stream")
 			stream, err := s.missionServiceClient.StreamUnits(ctx, request)
@@ -215,9 +342,17 @@ func (s *Streamer) receiveUnitStream(ctx context.Context, stream mission.Mission
 				log.Error().Err(err).Msg("received error from units stream")
 				return
 			}
-			updates <- Payload{
+			reference := s.currentReference()
+			payload, ok := s.filterUnit(Payload{
 				Update:      s.buildUpdate(response),
-				MissionTime: time.Second * time.Duration(response.GetTime()),
+				MissionTime: toMissionTime(response.GetTime()),
+				reference:   reference,
+			})
+			if !ok {
+				continue
+			}
+			if !send(ctx, updates, payload) {
+				return
 			}
 		}
 	}
@@ -226,17 +361,19 @@ func (s *Streamer) receiveUnitStream(ctx context.Context, stream mission.Mission
 func (s *Streamer) buildUpdate(resp *mission.StreamUnitsResponse) *objects.Update {
 	var update *objects.Update
 	if gone := resp.GetGone(); gone != nil {
+		s.untrackUnit(gone.GetId())
 		update = &objects.Update{
 			ID:        uint64(gone.GetId()),
 			IsRemoval: true,
 		}
 	} else if _unit := resp.GetUnit(); _unit != nil {
+		s.trackUnit(_unit.GetId())
 		update = &objects.Update{
 			ID:        uint64(_unit.GetId()),
 			IsRemoval: false,
 			Properties: map[string]string{
 				properties.Type:      s.buildType(_unit),
-				properties.Transform: s.buildCoordinates(_unit).Transform(0, 0),
+				properties.Transform: s.transform(buildCoordinates(_unit.GetPosition(), _unit.GetOrientation())),
 			},
 		}
 
@@ -251,24 +388,15 @@ func (s *Streamer) buildUpdate(resp *mission.StreamUnitsResponse) *objects.Updat
 		if _unit.Group != nil && _unit.Group.Name != "" {
 			update.Properties[properties.Group] = _unit.Group.Name
 		}
-		update.Properties[properties.Coalition] = convertCoalition(_unit.GetCoalition())
+		if country, ok := s.unitCountry(_unit.GetId(), _unit.GetName()); ok {
+			update.Properties[properties.Country] = country
+		}
+		update.Properties[properties.Coalition] = s.convertCoalition(_unit.GetCoalition())
 		update.Properties[properties.Color] = coalitionColor(_unit.GetCoalition())
 	}
 	return update
 }
 
-func convertCoalition(c common.Coalition) string {
-	switch c {
-	case common.Coalition_COALITION_RED:
-		return coalitions.Allies.String()
-	case common.Coalition_COALITION_BLUE:
-		return coalitions.Enemies.String()
-	case common.Coalition_COALITION_NEUTRAL:
-		return coalitions.Neutrals.String()
-	}
-	return ""
-}
-
 func coalitionColor(c common.Coalition) string {
 	switch c {
 	case common.Coalition_COALITION_RED:
@@ -295,16 +423,19 @@ func (s *Streamer) buildType(_unit *common.Unit) string {
 			types = append(types, tags.Ground)
 		case common.GroupCategory_GROUP_CATEGORY_SHIP:
 			types = append(types, tags.Sea)
+			if s.isCarrier(_unit.GetId()) {
+				types = append(types, tags.Watercraft, tags.AircraftCarrier)
+			}
 		}
 	}
 	return strings.Join(types, "+")
 }
 
-func (s *Streamer) buildCoordinates(_unit *common.Unit) *objects.Coordinates {
+func buildCoordinates(position *common.Position, orientation *common.Orientation) *objects.Coordinates {
 	var lon, lat *float64
 	var altitude *measure.Length
 	var u, v *float64
-	if position := _unit.GetPosition(); position != nil {
+	if position != nil {
 		lon = &position.Lon
 		lat = &position.Lat
 
@@ -316,7 +447,7 @@ func (s *Streamer) buildCoordinates(_unit *common.Unit) *objects.Coordinates {
 	}
 
 	var roll, pitch, yaw, heading *measure.Angle
-	if orientation := _unit.GetOrientation(); orientation != nil {
+	if orientation != nil {
 		r := measure.Angle(orientation.GetRoll()) * measure.Degree
 		roll = &r
 
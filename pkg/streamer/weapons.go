@@ -0,0 +1,331 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/dharmab/goacmi/objects"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/dharmab/goacmi/tags"
+	measure "github.com/martinlindhe/unit"
+	"github.com/rs/zerolog/log"
+)
+
+// trackedWeapon is a weapon in flight which was announced by a shot event.
+type trackedWeapon struct {
+	// parent is the ID of the unit which fired the weapon.
+	parent uint32
+	// coalition of the unit which fired the weapon.
+	coalition common.Coalition
+	// typed is true once the weapon's category has been read and its full Type published.
+	typed bool
+}
+
+// objectPosition is the position and orientation of an object as returned by positionLua.
+type objectPosition struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Alt     float64 `json:"alt"`
+	U       float64 `json:"u"`
+	V       float64 `json:"v"`
+	Heading float64 `json:"heading"`
+	Yaw     float64 `json:"yaw"`
+	Pitch   float64 `json:"pitch"`
+	Roll    float64 `json:"roll"`
+}
+
+// weaponState is the state of a single weapon as returned by weaponsLua.
+type weaponState struct {
+	Category int `json:"category"`
+	objectPosition
+}
+
+// weaponsResult is the result of weaponsLua.
+type weaponsResult struct {
+	Time    float64         `json:"time"`
+	Weapons json.RawMessage `json:"weapons"`
+}
+
+// positionLua defines a Lua function which describes the position and orientation of an object. It is prepended to
+// scripts which read positions. The heading is relative to the map grid, and the yaw is relative to true north, as in
+// DCS-gRPC's Orientation.
+const positionLua = `
+local function normalizeAngle(angle)
+	angle = angle %% 360
+	if angle < 0 then
+		angle = angle + 360
+	end
+	return angle
+end
+
+local function describePosition(object)
+	local position = object:getPosition()
+	local lat, lon, alt = coord.LOtoLL(position.p)
+	local heading = math.deg(math.atan2(position.x.z, position.x.x))
+	local north = coord.LLtoLO(lat + 1, lon)
+	local projectionError = math.deg(math.atan2(north.z - position.p.z, north.x - position.p.x))
+	return {
+		lat = lat,
+		lon = lon,
+		alt = alt,
+		u = position.p.z,
+		v = position.p.x,
+		heading = normalizeAngle(heading),
+		yaw = normalizeAngle(heading - projectionError),
+		pitch = math.deg(math.asin(position.x.y)),
+		roll = math.deg(math.atan2(-position.z.y, position.y.y)),
+	}
+end
+`
+
+// weaponsLua is evaluated in the mission scripting environment to read the state of weapons in flight. The %s verb is
+// replaced with a Lua table whose keys are the names of the weapons to read. DCS-gRPC uses a weapon's name as its ID.
+//
+// The scripting engine cannot look a weapon up by name, so weapon objects are kept in a global table which lasts
+// between evaluations. The whole map is only searched when a tracked weapon is not in that table, which usually means
+// it was fired since the last evaluation.
+const weaponsLua = positionLua + `
+local ids = %s
+acmiExporterWeapons = acmiExporterWeapons or {}
+local known = acmiExporterWeapons
+for id in pairs(known) do
+	if not ids[id] then
+		known[id] = nil
+	end
+end
+
+local function describeWeapon(weapon)
+	local state = describePosition(weapon)
+	state.category = weapon:getDesc().category
+	return state
+end
+
+local weapons = {}
+local missing = false
+for id in pairs(ids) do
+	local weapon = known[id]
+	if weapon ~= nil and weapon:isExist() then
+		weapons[id] = describeWeapon(weapon)
+	else
+		known[id] = nil
+		missing = true
+	end
+end
+
+if missing then
+	local volume = {
+		id = world.VolumeType.SPHERE,
+		params = { point = { x = 0, y = 0, z = 0 }, radius = 10000000 },
+	}
+	world.searchObjects(Object.Category.WEAPON, volume, function(weapon)
+		local id = weapon:getName()
+		if ids[id] and weapons[id] == nil then
+			known[id] = weapon
+			weapons[id] = describeWeapon(weapon)
+		end
+		return true
+	end)
+end
+return { time = timer.getTime(), weapons = weapons }
+`
+
+// Weapon categories as defined by Weapon.Category in the DCS scripting engine.
+const (
+	weaponCategoryShell   = 0
+	weaponCategoryMissile = 1
+	weaponCategoryRocket  = 2
+	weaponCategoryBomb    = 3
+	weaponCategoryTorpedo = 4
+)
+
+// trackWeapon starts tracking the weapon fired in the given shot event and returns an update which introduces the
+// weapon. Returns nil if the event does not describe a weapon.
+func (s *Streamer) trackWeapon(shot *mission.StreamEventsResponse_ShotEvent) *objects.Update {
+	weapon := shot.GetWeapon()
+	if weapon == nil {
+		return nil
+	}
+	tracked := &trackedWeapon{}
+	if shooter := shot.GetInitiator().GetUnit(); shooter != nil {
+		tracked.parent = shooter.GetId()
+		tracked.coalition = shooter.GetCoalition()
+	}
+
+	func() {
+		s.weaponsLock.Lock()
+		defer s.weaponsLock.Unlock()
+		s.weapons[weapon.GetId()] = tracked
+	}()
+
+	update := &objects.Update{
+		ID: uint64(weapon.GetId()),
+		Properties: map[string]string{
+			properties.Type:      tags.Weapon,
+			properties.Transform: s.transform(buildCoordinates(weapon.GetPosition(), weapon.GetOrientation())),
+			properties.Coalition: s.convertCoalition(tracked.coalition),
+			properties.Color:     coalitionColor(tracked.coalition),
+		},
+	}
+	if weapon.GetType() != "" {
+		update.Properties[properties.Name] = weapon.GetType()
+	}
+	if tracked.parent != 0 {
+		update.Properties[properties.Parent] = strconv.FormatUint(uint64(tracked.parent), 16)
+	}
+	return update
+}
+
+// untrackWeapon stops tracking the weapon with the given ID and returns an update which removes it. Returns nil if the
+// weapon was not being tracked.
+func (s *Streamer) untrackWeapon(id uint32) *objects.Update {
+	s.weaponsLock.Lock()
+	defer s.weaponsLock.Unlock()
+	if _, ok := s.weapons[id]; !ok {
+		return nil
+	}
+	delete(s.weapons, id)
+	return &objects.Update{ID: uint64(id), IsRemoval: true}
+}
+
+// resetWeapons stops tracking all weapons without removing them. It is used when the mission changes.
+func (s *Streamer) resetWeapons() {
+	s.weaponsLock.Lock()
+	defer s.weaponsLock.Unlock()
+	s.weapons = make(map[uint32]*trackedWeapon)
+}
+
+func (s *Streamer) streamWeapons(ctx context.Context, updates chan<- Payload, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reference := s.currentReference()
+			payloads, err := s.pollWeapons(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to poll weapons")
+				continue
+			}
+			for _, payload := range payloads {
+				payload.reference = reference
+				payload, ok := s.suppress(payload)
+				if !ok {
+					continue
+				}
+				if !send(ctx, updates, payload) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pollWeapons reads the state of all tracked weapons and returns updates for each. Weapons which no longer exist are
+// removed.
+func (s *Streamer) pollWeapons(ctx context.Context) ([]Payload, error) {
+	ids := s.trackedWeaponIDs()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, fmt.Sprintf("[%q] = true", strconv.FormatUint(uint64(id), 10)))
+	}
+	lua := fmt.Sprintf(weaponsLua, "{ "+strings.Join(keys, ", ")+" }")
+	resp, err := s.customServiceClient.Eval(ctx, &custom.EvalRequest{Lua: lua})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate weapons script: %w", err)
+	}
+
+	var result weaponsResult
+	if err := json.Unmarshal([]byte(resp.GetJson()), &result); err != nil {
+		return nil, fmt.Errorf("failed to decode weapons script result: %w", err)
+	}
+	states := make(map[string]weaponState)
+	// An empty Lua table may be encoded as either an empty JSON object or an empty JSON array.
+	if raw := bytes.TrimSpace(result.Weapons); len(raw) > 0 && !bytes.Equal(raw, []byte("[]")) {
+		if err := json.Unmarshal(raw, &states); err != nil {
+			return nil, fmt.Errorf("failed to decode weapon states: %w", err)
+		}
+	}
+
+	missionTime := toMissionTime(result.Time)
+	payloads := make([]Payload, 0, len(ids))
+	s.weaponsLock.Lock()
+	defer s.weaponsLock.Unlock()
+	for _, id := range ids {
+		tracked, ok := s.weapons[id]
+		if !ok {
+			// Removed by an event while the script was running
+			continue
+		}
+		state, ok := states[strconv.FormatUint(uint64(id), 10)]
+		if !ok {
+			delete(s.weapons, id)
+			payloads = append(payloads, Payload{
+				Update:      &objects.Update{ID: uint64(id), IsRemoval: true},
+				MissionTime: missionTime,
+			})
+			continue
+		}
+		update := &objects.Update{
+			ID: uint64(id),
+			Properties: map[string]string{
+				properties.Transform: s.transform(state.coordinates()),
+			},
+		}
+		if !tracked.typed {
+			update.Properties[properties.Type] = buildWeaponType(state.Category)
+			tracked.typed = true
+		}
+		payloads = append(payloads, Payload{Update: update, MissionTime: missionTime})
+	}
+	return payloads, nil
+}
+
+func (s *Streamer) trackedWeaponIDs() []uint32 {
+	s.weaponsLock.Lock()
+	defer s.weaponsLock.Unlock()
+	ids := make([]uint32, 0, len(s.weapons))
+	for id := range s.weapons {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func buildWeaponType(category int) string {
+	types := []string{tags.Weapon}
+	switch category {
+	case weaponCategoryShell:
+		types = append(types, tags.Shell)
+	case weaponCategoryMissile:
+		types = append(types, tags.Missile)
+	case weaponCategoryRocket:
+		types = append(types, tags.Rocket)
+	case weaponCategoryBomb:
+		types = append(types, tags.Bomb)
+	case weaponCategoryTorpedo:
+		types = append(types, tags.Torpedo)
+	}
+	return strings.Join(types, "+")
+}
+
+func (w *objectPosition) coordinates() *objects.Coordinates {
+	altitude := measure.Length(w.Alt) * measure.Meter
+	roll := measure.Angle(w.Roll) * measure.Degree
+	pitch := measure.Angle(w.Pitch) * measure.Degree
+	yaw := measure.Angle(w.Yaw) * measure.Degree
+	heading := measure.Angle(w.Heading) * measure.Degree
+	return objects.NewCoordinates(&w.Lon, &w.Lat, &altitude, &w.U, &w.V, &roll, &pitch, &yaw, &heading)
+}
@@ -0,0 +1,77 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/common"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/custom"
+	"github.com/DCS-gRPC/go-bindings/dcs/v0/mission"
+	"github.com/dharmab/goacmi/properties"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// evalClient returns a fixed result from Eval.
+type evalClient struct {
+	custom.CustomServiceClient
+	result string
+}
+
+func (c *evalClient) Eval(context.Context, *custom.EvalRequest, ...grpc.CallOption) (*custom.EvalResponse, error) {
+	return &custom.EvalResponse{Json: c.result}, nil
+}
+
+func TestPollWeapons(t *testing.T) {
+	t.Parallel()
+	client := &evalClient{}
+	s := &Streamer{
+		customServiceClient: client,
+		weapons:             make(map[uint32]*trackedWeapon),
+		precision:           DefaultPrecision,
+		coalitions:          DefaultCoalitionMapping,
+		reference:           reference{longitude: 41, latitude: 43, set: true},
+	}
+	shot := &mission.StreamEventsResponse_ShotEvent{
+		Initiator: &common.Initiator{Initiator: &common.Initiator_Unit{Unit: &common.Unit{Id: 0x10, Coalition: common.Coalition_COALITION_BLUE}}},
+		Weapon:    &common.Weapon{Id: 0x20, Type: "AIM_120C", Position: &common.Position{Lat: 43.5, Lon: 41.5, Alt: 5000}},
+	}
+	require.NotNil(t, s.trackWeapon(shot))
+
+	client.result = `{"time": 10, "weapons": {"32": {"category": 1, "lat": 43.5, "lon": 41.25, "alt": 5100, "u": 1, "v": 2, "heading": 92, "yaw": 90, "pitch": 5, "roll": -10}}}`
+	payloads, err := s.pollWeapons(context.Background())
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	update := payloads[0].Update
+	assert.Equal(t, uint64(0x20), update.ID)
+	assert.Equal(t, "0.25|0.5|5100|-10|5|90|1|2|92", update.Properties[properties.Transform])
+	assert.Equal(t, "Weapon+Missile", update.Properties[properties.Type])
+
+	payloads, err = s.pollWeapons(context.Background())
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	assert.NotContains(t, payloads[0].Update.Properties, properties.Type, "type is only published once")
+
+	client.result = `{"time": 11, "weapons": []}`
+	payloads, err = s.pollWeapons(context.Background())
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	assert.True(t, payloads[0].Update.IsRemoval)
+	assert.Empty(t, s.trackedWeaponIDs())
+}
+
+func TestUntrackWeapon(t *testing.T) {
+	t.Parallel()
+	s := &Streamer{weapons: make(map[uint32]*trackedWeapon), precision: DefaultPrecision, coalitions: DefaultCoalitionMapping}
+	require.NotNil(t, s.trackWeapon(&mission.StreamEventsResponse_ShotEvent{Weapon: &common.Weapon{Id: 0x20}}))
+
+	removal := s.untrackWeapon(0x20)
+	require.NotNil(t, removal)
+	assert.Equal(t, uint64(0x20), removal.ID)
+	assert.True(t, removal.IsRemoval)
+	assert.Empty(t, s.trackedWeaponIDs())
+
+	assert.Nil(t, s.untrackWeapon(0x20), "a weapon is only removed once")
+	assert.Nil(t, s.untrackWeapon(0x30), "unknown weapons are not removed")
+}